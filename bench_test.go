@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"rvld/pkg/linker"
+	"rvld/pkg/utils"
+	"testing"
+)
+
+// 生成一个目标文件，其中每个函数都和-ffunction-sections一样位于单独的段中，
+// 并且通过R_RISCV_CALL_PLT调用callees中对应的函数
+func writeFunctionSections(path string, funcs, callees []string) error {
+	// call f; ret
+	code := []byte{0x97, 0x00, 0x00, 0x00, 0xe7, 0x80, 0x00, 0x00, 0x67, 0x80, 0x00, 0x00}
+
+	var shstrtab, strtab bytes.Buffer
+	addName := func(b *bytes.Buffer, name string) uint32 {
+		off := uint32(b.Len())
+		b.WriteString(name)
+		b.WriteByte(0)
+		return off
+	}
+	addName(&shstrtab, "")
+	addName(&strtab, "")
+
+	// 段的顺序是: 各个函数段，各个.rela段，.symtab，.strtab，.shstrtab
+	n := len(funcs)
+	symtabIdx := uint32(2*n + 1)
+	shdrs := make([]linker.Shdr, 2*n+4)
+	contents := make([][]byte, len(shdrs))
+
+	// 符号的顺序是: 空符号，各个函数，各个被调用的函数
+	syms := make([]byte, (1+2*n)*linker.SymSize)
+	for i, name := range funcs {
+		shdrs[1+i] = linker.Shdr{
+			Name:      addName(&shstrtab, ".text."+name),
+			Type:      uint32(elf.SHT_PROGBITS),
+			Flags:     uint64(elf.SHF_ALLOC | elf.SHF_EXECINSTR),
+			Size:      uint64(len(code)),
+			AddrAlign: 4,
+		}
+		contents[1+i] = code
+
+		rela := make([]byte, linker.RelaSize)
+		utils.Write(rela, linker.Rela{Type: uint32(elf.R_RISCV_CALL_PLT), Sym: uint32(1 + n + i)})
+		shdrs[1+n+i] = linker.Shdr{
+			Name:      addName(&shstrtab, ".rela.text."+name),
+			Type:      uint32(elf.SHT_RELA),
+			Flags:     uint64(elf.SHF_INFO_LINK),
+			Size:      uint64(len(rela)),
+			Link:      symtabIdx,
+			Info:      uint32(1 + i),
+			AddrAlign: 8,
+			EntSize:   uint64(linker.RelaSize),
+		}
+		contents[1+n+i] = rela
+
+		utils.Write(syms[(1+i)*linker.SymSize:], linker.Sym{
+			Name:  addName(&strtab, name),
+			Info:  uint8(elf.STB_GLOBAL)<<4 | uint8(elf.STT_FUNC),
+			Shndx: uint16(1 + i),
+		})
+		utils.Write(syms[(1+n+i)*linker.SymSize:], linker.Sym{
+			Name: addName(&strtab, callees[i]),
+			Info: uint8(elf.STB_GLOBAL) << 4,
+		})
+	}
+
+	shdrs[symtabIdx] = linker.Shdr{
+		Name:      addName(&shstrtab, ".symtab"),
+		Type:      uint32(elf.SHT_SYMTAB),
+		Size:      uint64(len(syms)),
+		Link:      symtabIdx + 1,
+		Info:      1,
+		AddrAlign: 8,
+		EntSize:   uint64(linker.SymSize),
+	}
+	contents[symtabIdx] = syms
+	shdrs[symtabIdx+1] = linker.Shdr{Name: addName(&shstrtab, ".strtab"), Type: uint32(elf.SHT_STRTAB)}
+	contents[symtabIdx+1] = strtab.Bytes()
+	shdrs[symtabIdx+2] = linker.Shdr{Name: addName(&shstrtab, ".shstrtab"), Type: uint32(elf.SHT_STRTAB)}
+	contents[symtabIdx+2] = shstrtab.Bytes()
+
+	out := make([]byte, linker.EhdrSize)
+	for i := 1; i < len(shdrs); i++ {
+		for len(out)%8 != 0 {
+			out = append(out, 0)
+		}
+		shdrs[i].Offset = uint64(len(out))
+		shdrs[i].Size = uint64(len(contents[i]))
+		out = append(out, contents[i]...)
+	}
+	for len(out)%8 != 0 {
+		out = append(out, 0)
+	}
+
+	ehdr := linker.Ehdr{
+		Type:      uint16(elf.ET_REL),
+		Machine:   uint16(elf.EM_RISCV),
+		Version:   uint32(elf.EV_CURRENT),
+		ShOff:     uint64(len(out)),
+		EhSize:    uint16(linker.EhdrSize),
+		ShEntSize: uint16(linker.ShdrSize),
+		ShNum:     uint16(len(shdrs)),
+		ShStrndx:  uint16(len(shdrs) - 1),
+	}
+	copy(ehdr.Ident[:], elf.ELFMAG)
+	ehdr.Ident[elf.EI_CLASS] = uint8(elf.ELFCLASS64)
+	ehdr.Ident[elf.EI_DATA] = uint8(elf.ELFDATA2LSB)
+	ehdr.Ident[elf.EI_VERSION] = uint8(elf.EV_CURRENT)
+	utils.Write(out, ehdr)
+
+	for _, shdr := range shdrs {
+		buf := make([]byte, linker.ShdrSize)
+		utils.Write(buf, shdr)
+		out = append(out, buf...)
+	}
+	return os.WriteFile(path, out, 0o644)
+}
+
+// 生成numFiles个目标文件，每个文件中有sectionsPerFile个函数段，
+// 每个函数都调用下一个文件中对应的函数
+func writeManySections(tb testing.TB, numFiles, sectionsPerFile int) []string {
+	tb.Helper()
+	dir := tb.TempDir()
+	name := func(i, j int) string {
+		if i == 0 && j == 0 {
+			return "_start"
+		}
+		return fmt.Sprintf("f%d_%d", i, j)
+	}
+
+	var paths []string
+	for i := 0; i < numFiles; i++ {
+		var funcs, callees []string
+		for j := 0; j < sectionsPerFile; j++ {
+			funcs = append(funcs, name(i, j))
+			callees = append(callees, name((i+1)%numFiles, j))
+		}
+
+		path := filepath.Join(dir, fmt.Sprintf("%d.o", i))
+		if err := writeFunctionSections(path, funcs, callees); err != nil {
+			tb.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// 链接5万个输入段，加上-v时用--perf打印各个阶段的耗时
+func BenchmarkLinkManySections(b *testing.B) {
+	inputs := writeManySections(b, 50, 1000)
+	args := []string{"rvld", "-static", "-o", filepath.Join(b.TempDir(), "a.out")}
+	if testing.Verbose() {
+		args = append(args, "--perf")
+	}
+	args = append(args, inputs...)
+
+	saved := os.Args
+	defer func() { os.Args = saved }()
+	os.Args = args
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		main()
+	}
+}
+
+// utils.Read和utils.Write对内存布局和文件一致的结构体直接复制内存，
+// 下面和encoding/binary逐个字段解码的做法比较
+var (
+	benchSym  linker.Sym
+	benchSyms []linker.Sym
+)
+
+func BenchmarkReadSym(b *testing.B) {
+	data := make([]byte, linker.SymSize)
+
+	b.Run("fast", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			benchSym = utils.Read[linker.Sym](data)
+		}
+	})
+	b.Run("binary", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			utils.MustNo(binary.Read(bytes.NewReader(data), binary.LittleEndian, &benchSym))
+		}
+	})
+}
+
+func BenchmarkReadSymtab(b *testing.B) {
+	data := make([]byte, 10000*linker.SymSize)
+
+	b.Run("fast", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			benchSyms = utils.ReadSlice[linker.Sym](data, linker.SymSize)
+		}
+	})
+	b.Run("binary", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			benchSyms = make([]linker.Sym, len(data)/linker.SymSize)
+			utils.MustNo(binary.Read(bytes.NewReader(data), binary.LittleEndian, benchSyms))
+		}
+	})
+}
+
+func BenchmarkWriteRela(b *testing.B) {
+	buf := make([]byte, linker.RelaSize)
+	rel := linker.Rela{Offset: 0x1000, Type: uint32(elf.R_RISCV_64), Sym: 1, Addend: -8}
+
+	b.Run("fast", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			utils.Write(buf, rel)
+		}
+	})
+	b.Run("binary", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var w bytes.Buffer
+			utils.MustNo(binary.Write(&w, binary.LittleEndian, rel))
+			copy(buf, w.Bytes())
+		}
+	})
+}
+
+func BenchmarkPatchUint32(b *testing.B) {
+	buf := make([]byte, 4)
+
+	b.Run("fast", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			utils.Write[uint32](buf, utils.Read[uint32](buf)+1)
+		}
+	})
+	b.Run("binary", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var val uint32
+			utils.MustNo(binary.Read(bytes.NewReader(buf), binary.LittleEndian, &val))
+			var w bytes.Buffer
+			utils.MustNo(binary.Write(&w, binary.LittleEndian, val+1))
+			copy(buf, w.Bytes())
+		}
+	})
+}
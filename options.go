@@ -0,0 +1,483 @@
+package main
+
+import (
+	"debug/elf"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"rvld/pkg/linker"
+	"rvld/pkg/utils"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type argParser struct {
+	ctx       *linker.Context
+	args      []string
+	remaining []string
+}
+
+type option struct {
+	// 不带前缀的选项名，单个字母的只接受-x，其他的-x和--x都接受
+	names []string
+	// 参数的名字，为空表示这个选项不带参数。
+	// 写成[=N]表示参数可以省略，这时参数只能以--opt=N的形式给出
+	metavar string
+	help    string
+	handler func(p *argParser, arg string)
+}
+
+// 与位置相关的选项原样留给ReadInputFiles处理
+func positional(opt string) func(p *argParser, arg string) {
+	return func(p *argParser, arg string) {
+		p.remaining = append(p.remaining, opt)
+	}
+}
+
+func ignored(p *argParser, arg string) {}
+
+func parseCount(name string, arg string, min int) int {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < min {
+		utils.Fatal(fmt.Sprintf("--%s: expected an integer >= %d, but got: %s", name, min, arg))
+	}
+	return n
+}
+
+var options []option
+
+func init() {
+	options = []option{
+		{[]string{"help"}, "", "Print this help and exit", func(p *argParser, arg string) {
+			printHelp()
+			os.Exit(0)
+		}},
+		{[]string{"v", "version"}, "", "Print version and exit", func(p *argParser, arg string) {
+			fmt.Printf("rvld %s\n", version)
+			os.Exit(0)
+		}},
+		{[]string{"o", "output"}, "FILE", "Set output filename", func(p *argParser, arg string) {
+			p.ctx.Args.Output = arg
+		}},
+		{[]string{"m"}, "EMULATION", "Set target emulation (elf64lriscv)", func(p *argParser, arg string) {
+			if arg != "elf64lriscv" {
+				utils.Fatal(fmt.Sprintf("unknown -m argument: %s", arg))
+			}
+			p.ctx.Args.Emulation = linker.MachineTypeRISCV64
+		}},
+		{[]string{"L", "library-path"}, "DIR", "Add DIR to library search path", func(p *argParser, arg string) {
+			p.ctx.Args.LibraryPaths = append(p.ctx.Args.LibraryPaths, arg)
+		}},
+		{[]string{"l", "library"}, "LIBNAME", "Search for library LIBNAME, or the file NAME for -l:NAME", func(p *argParser, arg string) {
+			p.remaining = append(p.remaining, "-l"+arg)
+		}},
+		{[]string{"start-group", "("}, "", "Start a group of archives searched repeatedly", positional("--start-group")},
+		{[]string{"end-group", ")"}, "", "End a group", positional("--end-group")},
+		{[]string{"whole-archive"}, "", "Include all members of following archives", positional("--whole-archive")},
+		{[]string{"no-whole-archive"}, "", "Turn off --whole-archive", positional("--no-whole-archive")},
+		{[]string{"static"}, "", "Do not link against shared libraries", func(p *argParser, arg string) {
+			p.ctx.Args.IsStatic = true
+			p.remaining = append(p.remaining, "-Bstatic")
+		}},
+		{[]string{"Bstatic", "dn", "non_shared"}, "", "Following -l options search only archives", positional("-Bstatic")},
+		{[]string{"Bdynamic", "dy", "call_shared"}, "", "Following -l options also search shared libraries", positional("-Bdynamic")},
+		{[]string{"as-needed"}, "", "Only set DT_NEEDED for following libraries if used", positional("--as-needed")},
+		{[]string{"no-as-needed"}, "", "Always set DT_NEEDED for following libraries", positional("--no-as-needed")},
+		{[]string{"dynamic-linker", "I"}, "PATH", "Set the dynamic linker", func(p *argParser, arg string) {
+			p.ctx.Args.DynamicLinker = arg
+		}},
+		{[]string{"z"}, "KEYWORD", "Set a -z option, see below", func(p *argParser, arg string) {
+			parseZOption(p.ctx, arg)
+		}},
+		{[]string{"pie", "pic-executable"}, "", "Create a position independent executable", func(p *argParser, arg string) {
+			p.ctx.Args.Pie = true
+		}},
+		{[]string{"no-pie", "no-pic-executable"}, "", "Do not create a position independent executable", func(p *argParser, arg string) {
+			p.ctx.Args.Pie = false
+		}},
+		{[]string{"shared", "Bshareable"}, "", "Create a shared library", func(p *argParser, arg string) {
+			p.ctx.Args.Shared = true
+		}},
+		{[]string{"r", "relocatable"}, "", "Create a relocatable object file", func(p *argParser, arg string) {
+			p.ctx.Args.Relocatable = true
+			p.remaining = append(p.remaining, "-Bstatic")
+		}},
+		{[]string{"soname", "h"}, "NAME", "Set DT_SONAME", func(p *argParser, arg string) {
+			p.ctx.Args.Soname = arg
+		}},
+		{[]string{"pack-dyn-relocs"}, "[relr,none]", "Pack dynamic relocations", func(p *argParser, arg string) {
+			switch arg {
+			case "relr":
+				p.ctx.Args.PackDynRelocsRelr = true
+			case "none":
+				p.ctx.Args.PackDynRelocsRelr = false
+			default:
+				utils.Fatal(fmt.Sprintf("unknown --pack-dyn-relocs argument: %s", arg))
+			}
+		}},
+		{[]string{"compress-debug-sections"}, "[none,zlib,zstd]", "Compress .debug_* sections", func(p *argParser, arg string) {
+			switch arg {
+			case "none":
+				p.ctx.Args.CompressDebugSections = 0
+			case "zlib", "zlib-gabi":
+				p.ctx.Args.CompressDebugSections = elf.COMPRESS_ZLIB
+			case "zstd":
+				p.ctx.Args.CompressDebugSections = elf.COMPRESS_ZSTD
+			default:
+				utils.Fatal(fmt.Sprintf("unknown --compress-debug-sections argument: %s", arg))
+			}
+		}},
+		{[]string{"version-script"}, "FILE", "Read a version script", func(p *argParser, arg string) {
+			linker.ParseVersionScript(p.ctx, arg)
+		}},
+		{[]string{"s", "strip-all"}, "", "Strip all symbols", func(p *argParser, arg string) {
+			p.ctx.Args.StripAll = true
+		}},
+		{[]string{"threads"}, "[=N]", "Use N threads, or all available CPUs (default)", func(p *argParser, arg string) {
+			if arg == "" {
+				p.ctx.Args.Threads = runtime.NumCPU()
+			} else {
+				p.ctx.Args.Threads = parseCount("threads", arg, 1)
+			}
+		}},
+		{[]string{"no-threads"}, "", "Use a single thread", func(p *argParser, arg string) {
+			p.ctx.Args.Threads = 1
+		}},
+		{[]string{"error-limit"}, "N", "Stop after N errors, 0 for no limit (default 20)", func(p *argParser, arg string) {
+			p.ctx.Diag.Limit = parseCount("error-limit", arg, 0)
+		}},
+		{[]string{"color-diagnostics"}, "[=auto,always,never]", "Use colors in diagnostics (default auto)", func(p *argParser, arg string) {
+			switch arg {
+			case "", "always":
+				p.ctx.Diag.Color = true
+			case "never":
+				p.ctx.Diag.Color = false
+			case "auto":
+				p.ctx.Diag.Color = utils.IsTerminal(os.Stderr)
+			default:
+				utils.Fatal(fmt.Sprintf("unknown --color-diagnostics argument: %s", arg))
+			}
+		}},
+		{[]string{"no-color-diagnostics"}, "", "Do not use colors in diagnostics", func(p *argParser, arg string) {
+			p.ctx.Diag.Color = false
+		}},
+		{[]string{"print-stack-trace"}, "", "Print a stack trace on fatal errors", func(p *argParser, arg string) {
+			p.ctx.Diag.PrintStack = true
+		}},
+		{[]string{"Map"}, "FILE", "Write a link map to FILE", func(p *argParser, arg string) {
+			p.ctx.Args.MapFile = arg
+		}},
+		{[]string{"M", "print-map"}, "", "Print a link map to stdout", func(p *argParser, arg string) {
+			p.ctx.Args.PrintMap = true
+		}},
+		{[]string{"t", "trace"}, "", "Print each input file as it is loaded", func(p *argParser, arg string) {
+			p.ctx.Args.Trace = true
+		}},
+		{[]string{"cref"}, "", "Print a symbol cross reference table", func(p *argParser, arg string) {
+			p.ctx.Args.Cref = true
+		}},
+		{[]string{"why-extract"}, "FILE", "Write why archive members were extracted to FILE", func(p *argParser, arg string) {
+			p.ctx.Args.WhyExtract = arg
+		}},
+		{[]string{"y", "trace-symbol"}, "SYMBOL", "Trace definitions and references of SYMBOL", func(p *argParser, arg string) {
+			p.ctx.Args.TraceSymbols[arg] = true
+		}},
+		{[]string{"perf"}, "", "Print time spent in each phase", func(p *argParser, arg string) {
+			p.ctx.Args.Perf = true
+		}},
+		{[]string{"warn-backrefs"}, "", "Warn about backward archive references", func(p *argParser, arg string) {
+			p.ctx.Args.WarnBackrefs = true
+		}},
+		{[]string{"sysroot"}, "DIR", "Set the system root", func(p *argParser, arg string) {
+			p.ctx.Args.Sysroot = arg
+		}},
+		{[]string{"nostdlib"}, "", "Only search library directories given on the command line", func(p *argParser, arg string) {
+			p.ctx.Args.NoStdlib = true
+		}},
+		{[]string{"rpath", "R"}, "DIR", "Add DIR to DT_RUNPATH", func(p *argParser, arg string) {
+			p.ctx.Args.Rpaths = append(p.ctx.Args.Rpaths, arg)
+		}},
+		{[]string{"rpath-link"}, "DIR", "Add DIR to the search path of shared library dependencies", func(p *argParser, arg string) {
+			p.ctx.Args.RpathLinks = append(p.ctx.Args.RpathLinks, arg)
+		}},
+		{[]string{"plugin", "plugin-opt", "hash-style", "build-id"}, "ARG", "Ignored", ignored},
+		{[]string{"eh-frame-hdr"}, "", "Create .eh_frame_hdr and a PT_GNU_EH_FRAME segment", func(p *argParser, arg string) {
+			p.ctx.Args.EhFrameHdr = true
+		}},
+		{[]string{"no-eh-frame-hdr"}, "", "Do not create .eh_frame_hdr", func(p *argParser, arg string) {
+			p.ctx.Args.EhFrameHdr = false
+		}},
+		{[]string{"no-relax"}, "", "Ignored", ignored},
+	}
+}
+
+type zOption struct {
+	name    string
+	help    string
+	handler func(ctx *linker.Context, val string)
+}
+
+// -z的关键字，带值的写成name=，例如max-page-size=
+var zOptions = []zOption{
+	{"now", "Resolve all symbols at load time", func(ctx *linker.Context, val string) {
+		ctx.Args.ZNow = true
+	}},
+	{"lazy", "Resolve function symbols lazily (default)", func(ctx *linker.Context, val string) {
+		ctx.Args.ZNow = false
+	}},
+	{"copyreloc", "Allow copy relocations (default)", func(ctx *linker.Context, val string) {
+		ctx.Args.ZCopyreloc = true
+	}},
+	{"nocopyreloc", "Disallow copy relocations", func(ctx *linker.Context, val string) {
+		ctx.Args.ZCopyreloc = false
+	}},
+	{"relro", "Make relocated data read-only after loading (default)", func(ctx *linker.Context, val string) {
+		ctx.Args.ZRelro = true
+	}},
+	{"norelro", "Do not create PT_GNU_RELRO", func(ctx *linker.Context, val string) {
+		ctx.Args.ZRelro = false
+	}},
+	{"noexecstack", "Ignored", nil},
+	{"execstack", "Ignored", nil},
+	{"defs", "Ignored", nil},
+	{"undefs", "Ignored", nil},
+	{"origin", "Ignored", nil},
+	{"nodelete", "Ignored", nil},
+	{"nodlopen", "Ignored", nil},
+	{"nodefaultlib", "Ignored", nil},
+	{"text", "Ignored", nil},
+	{"notext", "Ignored", nil},
+	{"combreloc", "Ignored", nil},
+	{"nocombreloc", "Ignored", nil},
+	{"separate-code", "Ignored", nil},
+	{"noseparate-code", "Ignored", nil},
+	{"max-page-size=", "Ignored", nil},
+	{"common-page-size=", "Ignored", nil},
+	{"stack-size=", "Ignored", nil},
+}
+
+func parseZOption(ctx *linker.Context, arg string) {
+	for _, opt := range zOptions {
+		val := ""
+		if strings.HasSuffix(opt.name, "=") {
+			var ok bool
+			if val, ok = utils.RemovePrefix(arg, opt.name); !ok {
+				continue
+			}
+		} else if arg != opt.name {
+			continue
+		}
+
+		if opt.handler != nil {
+			opt.handler(ctx, val)
+		}
+		return
+	}
+
+	ctx.Diag.Warn(fmt.Sprintf("unknown -z option: %s", arg))
+}
+
+func (opt *option) hasOptionalArg() bool {
+	return strings.HasPrefix(opt.metavar, "[=")
+}
+
+func dashes(name string) []string {
+	if len(name) == 1 {
+		return []string{"-" + name}
+	}
+	return []string{"-" + name, "--" + name}
+}
+
+// 先找完全匹配的选项(包括--opt=val)，再找-oval这种参数紧跟在单字母选项后面的形式，
+// 这样-hash-style不会被当作-h ash-style
+func (p *argParser) parseOption() bool {
+	cur := p.args[0]
+	for _, opt := range options {
+		for _, name := range opt.names {
+			for _, prefix := range dashes(name) {
+				if cur == prefix {
+					if opt.metavar == "" || opt.hasOptionalArg() {
+						p.args = p.args[1:]
+						opt.handler(p, "")
+						return true
+					}
+
+					if len(p.args) == 1 {
+						utils.Fatal(fmt.Sprintf("option %s: argument missing", cur))
+					}
+					arg := p.args[1]
+					p.args = p.args[2:]
+					opt.handler(p, arg)
+					return true
+				}
+
+				if opt.metavar != "" && len(name) > 1 && strings.HasPrefix(cur, prefix+"=") {
+					p.args = p.args[1:]
+					opt.handler(p, cur[len(prefix)+1:])
+					return true
+				}
+			}
+		}
+	}
+
+	for _, opt := range options {
+		for _, name := range opt.names {
+			if opt.metavar != "" && len(name) == 1 && strings.HasPrefix(cur, "-"+name) {
+				p.args = p.args[1:]
+				opt.handler(p, cur[2:])
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func parseArgs(ctx *linker.Context) []string {
+	p := &argParser{ctx: ctx, args: expandResponseFiles(os.Args[1:], nil)}
+
+	for len(p.args) > 0 {
+		// 把-Wl,-rpath,/foo这样用逗号连接的选项拆开
+		if rest, ok := utils.RemovePrefix(p.args[0], "-Wl,"); ok {
+			p.args = append(strings.Split(rest, ","), p.args[1:]...)
+			continue
+		}
+
+		if p.parseOption() {
+			continue
+		}
+
+		if strings.HasPrefix(p.args[0], "-") {
+			utils.Fatal(fmt.Sprintf("unknown command line option: %s", p.args[0]))
+		}
+		p.remaining = append(p.remaining, p.args[0])
+		p.args = p.args[1:]
+	}
+
+	if ctx.Args.Relocatable && ctx.Args.Shared {
+		utils.Fatal("-r and -shared may not be used together")
+	}
+	if ctx.Args.Relocatable && ctx.Args.Pie {
+		utils.Fatal("-r and -pie may not be used together")
+	}
+
+	// 位置无关的输出文件从地址0开始，由动态链接器决定加载基址
+	if ctx.Args.IsPic() {
+		ctx.Args.ImageBase = 0
+	}
+
+	if !ctx.Args.NoStdlib {
+		ctx.Args.LibraryPaths = append(ctx.Args.LibraryPaths, linker.DefaultLibraryPaths...)
+	}
+	for i, path := range ctx.Args.LibraryPaths {
+		ctx.Args.LibraryPaths[i] = filepath.Clean(linker.ResolveSysrootPath(ctx, path))
+	}
+
+	return p.remaining
+}
+
+// 把@file替换为文件中的参数，文件中还可以再引用其他响应文件。
+// 和GCC一样，读不到的@file原样保留
+func expandResponseFiles(args []string, visiting []string) []string {
+	ret := make([]string, 0, len(args))
+	for _, arg := range args {
+		path, ok := utils.RemovePrefix(arg, "@")
+		if !ok {
+			ret = append(ret, arg)
+			continue
+		}
+
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			ret = append(ret, arg)
+			continue
+		}
+
+		for _, v := range visiting {
+			if v == path {
+				utils.Fatal(fmt.Sprintf("%s: recursive response file", path))
+			}
+		}
+
+		visiting = append(visiting, path)
+		ret = append(ret, expandResponseFiles(tokenizeResponseFile(string(contents)), visiting)...)
+		visiting = visiting[:len(visiting)-1]
+	}
+	return ret
+}
+
+// GNU的规则：空白分隔参数，单引号和双引号中的空白不分隔，反斜杠转义下一个字符
+func tokenizeResponseFile(contents string) []string {
+	tokens := make([]string, 0)
+	var b strings.Builder
+	inToken := false
+	var quote byte
+
+	for i := 0; i < len(contents); i++ {
+		c := contents[i]
+		switch {
+		case c == '\\' && i+1 < len(contents):
+			i++
+			b.WriteByte(contents[i])
+			inToken = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				b.WriteByte(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inToken = true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v':
+			if inToken {
+				tokens = append(tokens, b.String())
+				b.Reset()
+				inToken = false
+			}
+		default:
+			b.WriteByte(c)
+			inToken = true
+		}
+	}
+
+	if inToken {
+		tokens = append(tokens, b.String())
+	}
+	return tokens
+}
+
+func printHelp() {
+	fmt.Printf("Usage: %s [options] file...\n\nOptions:\n", os.Args[0])
+	for _, opt := range options {
+		forms := make([]string, 0)
+		for _, name := range opt.names {
+			d := dashes(name)
+			form := d[len(d)-1]
+			if opt.hasOptionalArg() {
+				form += opt.metavar
+			} else if opt.metavar != "" {
+				if len(name) == 1 {
+					form += " " + opt.metavar
+				} else {
+					form += "=" + opt.metavar
+				}
+			}
+			forms = append(forms, form)
+		}
+		fmt.Printf("  %-40s %s\n", strings.Join(forms, ", "), opt.help)
+	}
+
+	names := make([]string, 0, len(zOptions))
+	for _, opt := range zOptions {
+		if opt.handler != nil {
+			fmt.Printf("  -z %-37s %s\n", opt.name, opt.help)
+		} else {
+			names = append(names, opt.name)
+		}
+	}
+	sort.Strings(names)
+	fmt.Printf("\n  Also accepted and ignored: -z %s\n", strings.Join(names, ", -z "))
+}
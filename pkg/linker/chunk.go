@@ -5,9 +5,17 @@ type Chunker interface {
 	GetShdr() *Shdr
 	UpdateShdr(ctx *Context)
 	GetShndx() int64
+	SetShndx(shndx int64)
 	CopyBuf(ctx *Context)
 }
 
+// 写入时可以拆成多个互不重叠的任务的Chunk，由CopyChunks和其他Chunk的写入放在同一层并行执行。
+// 所有任务结束之后再调用finish
+type splitChunker interface {
+	Chunker
+	CopyJobs(ctx *Context) (jobs []func(), finish func())
+}
+
 type Chunk struct {
 	Name  string
 	Shdr  Shdr
@@ -34,6 +42,10 @@ func (c *Chunk) GetShndx() int64 {
 	return c.Shndx
 }
 
+func (c *Chunk) SetShndx(shndx int64) {
+	c.Shndx = shndx
+}
+
 func (c *Chunk) GetShdr() *Shdr {
 	return &c.Shdr
 }
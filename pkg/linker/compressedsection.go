@@ -0,0 +1,66 @@
+package linker
+
+import (
+	"bytes"
+	"compress/zlib"
+	"debug/elf"
+	"rvld/pkg/utils"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// 在ctx.Chunks中代替原来的.debug_*段，内容是Chdr加上压缩后的数据
+type CompressedSection struct {
+	Chunk
+	Contents []byte
+}
+
+// 能把内容写到指定缓冲区中的段，压缩前先把内容写到一个单独的缓冲区里
+type sectionWriter interface {
+	Chunker
+	WriteTo(ctx *Context, buf []byte)
+}
+
+func NewCompressedSection(ctx *Context, chunk sectionWriter) *CompressedSection {
+	shdr := chunk.GetShdr()
+	buf := make([]byte, shdr.Size)
+	chunk.WriteTo(ctx, buf)
+
+	c := &CompressedSection{Chunk: NewChunk()}
+	c.Name = chunk.GetName()
+	c.Shndx = chunk.GetShndx()
+	c.Shdr = *shdr
+	c.Shdr.Flags |= uint64(elf.SHF_COMPRESSED)
+	c.Shdr.AddrAlign = 8
+
+	c.Contents = make([]byte, ChdrSize)
+	utils.Write[Chdr](c.Contents, Chdr{
+		Type:      uint32(ctx.Args.CompressDebugSections),
+		Size:      shdr.Size,
+		AddrAlign: shdr.AddrAlign,
+	})
+
+	switch ctx.Args.CompressDebugSections {
+	case elf.COMPRESS_ZLIB:
+		out := bytes.NewBuffer(c.Contents)
+		w := zlib.NewWriter(out)
+		_, err := w.Write(buf)
+		utils.MustNo(err)
+		utils.MustNo(w.Close())
+		c.Contents = out.Bytes()
+	case elf.COMPRESS_ZSTD:
+		w, err := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		utils.MustNo(err)
+		c.Contents = w.EncodeAll(buf, c.Contents)
+		utils.MustNo(w.Close())
+	default:
+		utils.Fatal("unreachable")
+	}
+
+	c.Shdr.Size = uint64(len(c.Contents))
+	return c
+}
+
+func (c *CompressedSection) CopyBuf(ctx *Context) {
+	copy(ctx.Buf[c.Shdr.Offset:], c.Contents)
+}
@@ -1,74 +1,166 @@
 package linker
 
-import "debug/elf"
+import (
+	"debug/elf"
+	"runtime"
+	"rvld/pkg/utils"
+	"sync/atomic"
+)
 
 type ContextArgs struct {
-	Output       string
-	Emulation    MachineType
-	LibraryPaths []string
+	Output        string
+	Emulation     MachineType
+	LibraryPaths  []string
+	WarnBackrefs  bool
+	Perf          bool
+	MapFile       string
+	PrintMap      bool
+	Cref          bool
+	Trace         bool
+	WhyExtract    string
+	TraceSymbols  map[string]bool
+	Threads       int
+	IsStatic      bool
+	DynamicLinker string
+	ZNow          bool
+	ZCopyreloc    bool
+	ZRelro        bool
+	Pie           bool
+	StripAll      bool
+	Shared        bool
+	Relocatable   bool
+	Soname        string
+	Sysroot       string
+	NoStdlib      bool
+	Rpaths        []string
+	RpathLinks    []string
+	ImageBase     uint64
+
+	PackDynRelocsRelr bool
+	// 为0时不压缩
+	CompressDebugSections elf.CompressionType
+	EhFrameHdr            bool
+
+	VersionDefinitions []VersionDefinition
+	VersionPatterns    []VersionPattern
 }
 
 type Context struct {
-	Args ContextArgs
-	Buf  []byte
+	Args   ContextArgs
+	Reader ReaderContext
+	Buf    []byte
 
 	Ehdr *OutputEhdr
 	Shdr *OutputShdr
 	Phdr *OutputPhdr
 	Got  *GotSection
 
+	Shstrtab *ShstrtabSection
+	Symtab   *SymtabSection
+	Strtab   *StrtabSection
+	Interp   *InterpSection
+	Dynamic  *DynamicSection
+	Dynsym   *DynsymSection
+	Dynstr   *DynstrSection
+	Hash     *HashSection
+	RelDyn   *RelDynSection
+	RelrDyn  *RelrDynSection
+	Plt      *PltSection
+	GotPlt   *GotPltSection
+	RelPlt   *RelPltSection
+	Versym   *VersymSection
+	Verdef   *VerdefSection
+	Verneed  *VerneedSection
+
+	Iplt    *IpltSection
+	RelIplt *RelIpltSection
+
+	EhFrame    *EhFrameSection
+	EhFrameHdr *EhFrameHdrSection
+
+	Copyrel      *CopyrelSection
+	CopyrelRelro *CopyrelSection
+
 	TpAddr uint64
 
-	OutputSections []*OutputSection
-	Chunks         []Chunker
+	OutputSections   []*OutputSection
+	OutputSectionMap map[SectionKey]*OutputSection
+	Chunks           []Chunker
+
+	Objs             []*ObjectFile
+	InternalObj      *ObjectFile
+	Dsos             []*SharedFile
+	DsoMap           map[*InputFile]*SharedFile
+	SymbolMap        *utils.ShardedMap[*Symbol]
+	Diag             *Diagnostics
+	MergedSections   []*MergedSection
+	MergedSectionMap map[SectionKey]*MergedSection
+
+	// 本次链接映射到内存中的文件，按文件名复用已经打开过的输入文件
+	Mappings utils.Mappings
+	Files    map[string]*File
+}
 
-	Objs           []*ObjectFile
-	SymbolMap      map[string]*Symbol
-	MergedSections []*MergedSection
+// 名字、类型和标志位都相同的输入段会被合并到同一个输出段中
+type SectionKey struct {
+	Name  string
+	Type  uint32
+	Flags uint64
 }
 
 func NewContext() *Context {
 	return &Context{
 		Args: ContextArgs{
-			Output:    "a.out",
-			Emulation: MachineTypeNone,
+			Output:        "a.out",
+			Emulation:     MachineTypeNone,
+			DynamicLinker: "/lib/ld-linux-riscv64-lp64d.so.1",
+			ZCopyreloc:    true,
+			ZRelro:        true,
+			ImageBase:     IMAGE_BASE,
+			Threads:       runtime.NumCPU(),
+			TraceSymbols:  make(map[string]bool),
 		},
-		SymbolMap: make(map[string]*Symbol),
+		SymbolMap:        utils.NewShardedMap[*Symbol](),
+		Diag:             NewDiagnostics(),
+		OutputSectionMap: make(map[SectionKey]*OutputSection),
+		MergedSectionMap: make(map[SectionKey]*MergedSection),
+		DsoMap:           make(map[*InputFile]*SharedFile),
+		Files:            make(map[string]*File),
 	}
 }
 
+// 输出文件在运行时可以被加载到任意地址
+func (a *ContextArgs) IsPic() bool {
+	return a.Pie || a.Shared
+}
+
 func GetMergedSectionInstance(ctx *Context, name string, typ uint32, flags uint64) *MergedSection {
 	name = GetOutputName(name, flags)
 	flags = flags & ^uint64(elf.SHF_GROUP) & ^uint64(elf.SHF_MERGE) &
 		^uint64(elf.SHF_STRINGS) & ^uint64(elf.SHF_COMPRESSED)
 
-	find := func() *MergedSection {
-		for _, section := range ctx.MergedSections {
-			if name == section.Name && flags == section.Shdr.Flags && typ == section.Shdr.Type {
-				return section
-			}
-		}
-		return nil
-	}
-
-	if section := find(); section != nil {
+	key := SectionKey{Name: name, Type: typ, Flags: flags}
+	if section, ok := ctx.MergedSectionMap[key]; ok {
 		return section
 	}
 
 	section := NewMergedSection(name, flags, typ)
 	ctx.MergedSections = append(ctx.MergedSections, section)
+	ctx.MergedSectionMap[key] = section
 	return section
 }
 
 func (m *MergedSection) Insert(key string, p2align uint32) *SectionFragment {
-	frag, ok := m.Map[key]
-	if !ok {
-		frag = NewSectionFragment(m)
-		m.Map[key] = frag
-	}
+	frag := m.Map.GetOrInsert(key, func() *SectionFragment {
+		return NewSectionFragment(m)
+	})
 
-	if frag.P2Align < p2align {
-		frag.P2Align = p2align
+	// 多个线程可能同时插入同一个片段
+	for {
+		old := atomic.LoadUint32(&frag.P2Align)
+		if old >= p2align || atomic.CompareAndSwapUint32(&frag.P2Align, old, p2align) {
+			break
+		}
 	}
 
 	return frag
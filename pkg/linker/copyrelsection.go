@@ -0,0 +1,59 @@
+package linker
+
+import (
+	"debug/elf"
+	"rvld/pkg/utils"
+)
+
+type CopyrelSection struct {
+	Chunk
+	Symbols      []*Symbol
+	IsRelro      bool
+	RelDynOffset uint64
+}
+
+func NewCopyrelSection(isRelro bool) *CopyrelSection {
+	c := &CopyrelSection{Chunk: NewChunk(), IsRelro: isRelro}
+	if isRelro {
+		c.Name = ".copyrel.rel.ro"
+	} else {
+		c.Name = ".copyrel"
+	}
+	c.Shdr.Type = uint32(elf.SHT_NOBITS)
+	c.Shdr.Flags = uint64(elf.SHF_ALLOC | elf.SHF_WRITE)
+	return c
+}
+
+func (c *CopyrelSection) AddSymbol(ctx *Context, file *SharedFile, sym *Symbol) {
+	if sym.HasCopyrel {
+		return
+	}
+
+	align := file.GetAlignment(sym)
+	offset := utils.AlignTo(c.Shdr.Size, align)
+	c.Shdr.Size = offset + sym.ElfSym().Size
+	if c.Shdr.AddrAlign < align {
+		c.Shdr.AddrAlign = align
+	}
+
+	// 同一地址上的别名都要指向复制出来的数据
+	for _, alias := range file.FindAliases(sym) {
+		alias.HasCopyrel = true
+		alias.IsCopyrelReadonly = c.IsRelro
+		alias.Value = offset
+		ctx.Dynsym.AddSymbol(ctx, alias)
+	}
+
+	c.Symbols = append(c.Symbols, sym)
+}
+
+func (c *CopyrelSection) CopyBuf(ctx *Context) {
+	base := ctx.Buf[ctx.RelDyn.Shdr.Offset+c.RelDynOffset:]
+	for i, sym := range c.Symbols {
+		utils.Write[Rela](base[i*RelaSize:], Rela{
+			Offset: sym.GetAddr(ctx),
+			Type:   uint32(elf.R_RISCV_COPY),
+			Sym:    uint32(sym.DynsymIdx),
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package linker
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"rvld/pkg/utils"
+	"sort"
+)
+
+// 和GNU ld一样，有-Map时交叉引用表追加到映射文件的末尾，否则输出到标准输出
+func PrintCref(ctx *Context) {
+	if !ctx.Args.Cref {
+		return
+	}
+
+	if ctx.Args.MapFile != "" {
+		file, err := os.OpenFile(ctx.Args.MapFile, os.O_WRONLY|os.O_APPEND, 0)
+		utils.MustNo(err)
+		w := bufio.NewWriter(file)
+		writeCref(ctx, w)
+		utils.MustNo(w.Flush())
+		utils.MustNo(file.Close())
+		return
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	writeCref(ctx, w)
+	utils.MustNo(w.Flush())
+}
+
+// 每个全局符号先列出定义它的文件，再列出引用它的文件
+func writeCref(ctx *Context, w io.Writer) {
+	refs := make(map[*Symbol][]*File)
+	syms := make([]*Symbol, 0)
+
+	addRefs := func(file *InputFile) {
+		for i := file.FirstGlobal; i < len(file.ElfSyms); i++ {
+			sym := file.Symbols[i]
+			if sym.File == file || !file.ElfSyms[i].IsUndef() {
+				continue
+			}
+
+			if _, ok := refs[sym]; !ok {
+				syms = append(syms, sym)
+			}
+			refs[sym] = append(refs[sym], file.File)
+		}
+	}
+
+	for _, file := range ctx.Objs {
+		if file.IsAlive {
+			addRefs(&file.InputFile)
+		}
+	}
+	for _, file := range ctx.Dsos {
+		if file.IsAlive {
+			addRefs(&file.InputFile)
+		}
+	}
+
+	// 没有被引用的符号也要列出
+	addDefs := func(file *InputFile) {
+		for _, sym := range file.Symbols[file.FirstGlobal:] {
+			if sym.File == file {
+				if _, ok := refs[sym]; !ok {
+					syms = append(syms, sym)
+					refs[sym] = nil
+				}
+			}
+		}
+	}
+
+	for _, file := range ctx.Objs {
+		if file.IsAlive {
+			addDefs(&file.InputFile)
+		}
+	}
+	for _, file := range ctx.Dsos {
+		if file.IsAlive {
+			addDefs(&file.InputFile)
+		}
+	}
+
+	sort.SliceStable(syms, func(i, j int) bool {
+		return syms[i].Name < syms[j].Name
+	})
+
+	fmt.Fprintf(w, "\nCross Reference Table\n\n")
+	fmt.Fprintf(w, "%-50s%s\n", "Symbol", "File")
+	for _, sym := range syms {
+		name := sym.Name
+		if sym.File != nil {
+			fmt.Fprintf(w, "%-50s%s\n", name, sym.File.File)
+			name = ""
+		}
+		for _, file := range refs[sym] {
+			fmt.Fprintf(w, "%-50s%s\n", name, file)
+			name = ""
+		}
+	}
+}
+
+// 以TSV格式输出每个归档成员是因为哪个文件中的哪个符号被拉进来的，"-"表示标准输出
+func PrintWhyExtract(ctx *Context) {
+	if ctx.Args.WhyExtract == "" {
+		return
+	}
+
+	out := os.Stdout
+	if ctx.Args.WhyExtract != "-" {
+		file, err := os.Create(ctx.Args.WhyExtract)
+		utils.MustNo(err)
+		defer func() {
+			utils.MustNo(file.Close())
+		}()
+		out = file
+	}
+
+	w := bufio.NewWriter(out)
+	fmt.Fprintf(w, "reference\textracted\tsymbol\n")
+	for _, file := range ctx.Objs {
+		if !file.IsAlive || file.File.Parent == nil {
+			continue
+		}
+
+		if file.ExtractedBy != nil {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", file.ExtractedBy.File, file.File,
+				file.ExtractedSym.Name)
+		} else {
+			fmt.Fprintf(w, "--whole-archive\t%s\t\n", file.File)
+		}
+	}
+	utils.MustNo(w.Flush())
+}
+
+// -y指定的符号在每个文件中是定义还是引用
+func TraceSymbols(ctx *Context) {
+	if len(ctx.Args.TraceSymbols) == 0 {
+		return
+	}
+
+	trace := func(file *InputFile, isLazy bool) {
+		for i := file.FirstGlobal; i < len(file.ElfSyms); i++ {
+			sym := file.Symbols[i]
+			if !ctx.Args.TraceSymbols[sym.Name] {
+				continue
+			}
+
+			elfSym := &file.ElfSyms[i]
+			switch {
+			case elfSym.IsUndef():
+				if !isLazy {
+					fmt.Printf("%s: reference to %s\n", file.File, sym.Name)
+				}
+			case file.IsDso:
+				fmt.Printf("%s: shared definition of %s\n", file.File, sym.Name)
+			case isLazy:
+				fmt.Printf("%s: lazy definition of %s\n", file.File, sym.Name)
+			case elfSym.IsCommon():
+				fmt.Printf("%s: common definition of %s\n", file.File, sym.Name)
+			default:
+				fmt.Printf("%s: definition of %s\n", file.File, sym.Name)
+			}
+		}
+	}
+
+	for _, file := range ctx.Objs {
+		trace(&file.InputFile, !file.IsAlive)
+	}
+	for _, file := range ctx.Dsos {
+		trace(&file.InputFile, false)
+	}
+}
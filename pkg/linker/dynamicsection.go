@@ -0,0 +1,129 @@
+package linker
+
+import (
+	"debug/elf"
+	"rvld/pkg/utils"
+	"strings"
+)
+
+type DynamicSection struct {
+	Chunk
+}
+
+func NewDynamicSection() *DynamicSection {
+	d := &DynamicSection{Chunk: NewChunk()}
+	d.Name = ".dynamic"
+	d.Shdr.Type = uint32(elf.SHT_DYNAMIC)
+	d.Shdr.Flags = uint64(elf.SHF_ALLOC | elf.SHF_WRITE)
+	d.Shdr.EntSize = uint64(DynSize)
+	d.Shdr.AddrAlign = 8
+	return d
+}
+
+func createDynamicContents(ctx *Context) []Dyn {
+	vec := make([]Dyn, 0)
+	define := func(tag elf.DynTag, val uint64) {
+		vec = append(vec, Dyn{Tag: int64(tag), Val: val})
+	}
+
+	for _, file := range ctx.Dsos {
+		define(elf.DT_NEEDED, uint64(ctx.Dynstr.GetOffset(file.Soname)))
+	}
+
+	if ctx.Args.Soname != "" {
+		define(elf.DT_SONAME, uint64(ctx.Dynstr.GetOffset(ctx.Args.Soname)))
+	}
+
+	if len(ctx.Args.Rpaths) > 0 {
+		define(elf.DT_RUNPATH,
+			uint64(ctx.Dynstr.GetOffset(strings.Join(ctx.Args.Rpaths, ":"))))
+	}
+
+	if ctx.RelDyn.Shdr.Size > 0 {
+		define(elf.DT_RELA, ctx.RelDyn.Shdr.Addr)
+		define(elf.DT_RELASZ, ctx.RelDyn.Shdr.Size)
+		define(elf.DT_RELAENT, uint64(RelaSize))
+	}
+
+	if ctx.RelrDyn != nil && ctx.RelrDyn.Shdr.Size > 0 {
+		define(DT_RELR, ctx.RelrDyn.Shdr.Addr)
+		define(DT_RELRSZ, ctx.RelrDyn.Shdr.Size)
+		define(DT_RELRENT, 8)
+	}
+
+	if ctx.RelPlt.Shdr.Size > 0 {
+		define(elf.DT_JMPREL, ctx.RelPlt.Shdr.Addr)
+		define(elf.DT_PLTRELSZ, ctx.RelPlt.Shdr.Size)
+		define(elf.DT_PLTREL, uint64(elf.DT_RELA))
+	}
+
+	if ctx.GotPlt.Shdr.Size > 0 {
+		define(elf.DT_PLTGOT, ctx.GotPlt.Shdr.Addr)
+	}
+
+	define(elf.DT_HASH, ctx.Hash.Shdr.Addr)
+	define(elf.DT_STRTAB, ctx.Dynstr.Shdr.Addr)
+	define(elf.DT_STRSZ, ctx.Dynstr.Shdr.Size)
+	define(elf.DT_SYMTAB, ctx.Dynsym.Shdr.Addr)
+	define(elf.DT_SYMENT, uint64(SymSize))
+
+	if ctx.Versym.Shdr.Size > 0 {
+		define(elf.DT_VERSYM, ctx.Versym.Shdr.Addr)
+	}
+	if ctx.Verdef != nil && ctx.Verdef.Shdr.Size > 0 {
+		define(elf.DT_VERDEF, ctx.Verdef.Shdr.Addr)
+		define(elf.DT_VERDEFNUM, uint64(ctx.Verdef.Shdr.Info))
+	}
+	if ctx.Verneed.Shdr.Size > 0 {
+		define(elf.DT_VERNEED, ctx.Verneed.Shdr.Addr)
+		define(elf.DT_VERNEEDNUM, uint64(ctx.Verneed.Shdr.Info))
+	}
+
+	for _, chunk := range ctx.Chunks {
+		shdr := chunk.GetShdr()
+		switch elf.SectionType(shdr.Type) {
+		case elf.SHT_INIT_ARRAY:
+			define(elf.DT_INIT_ARRAY, shdr.Addr)
+			define(elf.DT_INIT_ARRAYSZ, shdr.Size)
+		case elf.SHT_FINI_ARRAY:
+			define(elf.DT_FINI_ARRAY, shdr.Addr)
+			define(elf.DT_FINI_ARRAYSZ, shdr.Size)
+		case elf.SHT_PREINIT_ARRAY:
+			define(elf.DT_PREINIT_ARRAY, shdr.Addr)
+			define(elf.DT_PREINIT_ARRAYSZ, shdr.Size)
+		}
+	}
+
+	flags := uint64(0)
+	flags1 := uint64(0)
+	if ctx.Args.ZNow {
+		flags |= uint64(elf.DF_BIND_NOW)
+		flags1 |= uint64(elf.DF_1_NOW)
+	}
+	if ctx.Args.Pie && !ctx.Args.Shared {
+		flags1 |= uint64(elf.DF_1_PIE)
+	}
+
+	if flags != 0 {
+		define(elf.DT_FLAGS, flags)
+	}
+	if flags1 != 0 {
+		define(elf.DT_FLAGS_1, flags1)
+	}
+
+	// 调试器通过可执行文件中的DT_DEBUG找到动态链接器的数据结构
+	if !ctx.Args.Shared {
+		define(elf.DT_DEBUG, 0)
+	}
+	define(elf.DT_NULL, 0)
+	return vec
+}
+
+func (d *DynamicSection) UpdateShdr(ctx *Context) {
+	d.Shdr.Size = uint64(len(createDynamicContents(ctx))) * uint64(DynSize)
+	d.Shdr.Link = uint32(ctx.Dynstr.Shndx)
+}
+
+func (d *DynamicSection) CopyBuf(ctx *Context) {
+	utils.Write(ctx.Buf[d.Shdr.Offset:], createDynamicContents(ctx))
+}
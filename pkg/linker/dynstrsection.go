@@ -0,0 +1,53 @@
+package linker
+
+import (
+	"debug/elf"
+	"rvld/pkg/utils"
+)
+
+type DynstrSection struct {
+	Chunk
+	Strings []string
+	Offsets map[string]uint32
+}
+
+func NewDynstrSection() *DynstrSection {
+	d := &DynstrSection{
+		Chunk:   NewChunk(),
+		Offsets: make(map[string]uint32),
+	}
+	d.Name = ".dynstr"
+	d.Shdr.Type = uint32(elf.SHT_STRTAB)
+	d.Shdr.Flags = uint64(elf.SHF_ALLOC)
+	// 第一个字节是空字符串
+	d.Shdr.Size = 1
+	return d
+}
+
+func (d *DynstrSection) AddString(str string) uint32 {
+	if offset, ok := d.Offsets[str]; ok {
+		return offset
+	}
+
+	offset := uint32(d.Shdr.Size)
+	d.Offsets[str] = offset
+	d.Strings = append(d.Strings, str)
+	d.Shdr.Size += uint64(len(str)) + 1
+	return offset
+}
+
+func (d *DynstrSection) GetOffset(str string) uint32 {
+	offset, ok := d.Offsets[str]
+	utils.Assert(ok)
+	return offset
+}
+
+func (d *DynstrSection) CopyBuf(ctx *Context) {
+	base := ctx.Buf[d.Shdr.Offset:]
+	base[0] = 0
+	for _, str := range d.Strings {
+		offset := d.Offsets[str]
+		copy(base[offset:], str)
+		base[offset+uint32(len(str))] = 0
+	}
+}
@@ -0,0 +1,77 @@
+package linker
+
+import (
+	"debug/elf"
+	"rvld/pkg/utils"
+)
+
+type DynsymSection struct {
+	Chunk
+	Symbols []*Symbol
+}
+
+func NewDynsymSection() *DynsymSection {
+	d := &DynsymSection{Chunk: NewChunk()}
+	d.Name = ".dynsym"
+	d.Shdr.Type = uint32(elf.SHT_DYNSYM)
+	d.Shdr.Flags = uint64(elf.SHF_ALLOC)
+	d.Shdr.EntSize = uint64(SymSize)
+	d.Shdr.AddrAlign = 8
+	return d
+}
+
+func (d *DynsymSection) AddSymbol(ctx *Context, sym *Symbol) {
+	if sym.DynsymIdx != -1 {
+		return
+	}
+
+	// 下标0是空符号
+	sym.DynsymIdx = int32(len(d.Symbols) + 1)
+	d.Symbols = append(d.Symbols, sym)
+	ctx.Dynstr.AddString(sym.Name)
+}
+
+func (d *DynsymSection) UpdateShdr(ctx *Context) {
+	d.Shdr.Size = uint64(len(d.Symbols)+1) * uint64(SymSize)
+	d.Shdr.Link = uint32(ctx.Dynstr.Shndx)
+	d.Shdr.Info = 1
+}
+
+func (d *DynsymSection) CopyBuf(ctx *Context) {
+	base := ctx.Buf[d.Shdr.Offset:]
+	utils.Write[Sym](base, Sym{})
+
+	for _, sym := range d.Symbols {
+		elfSym := sym.ElfSym()
+		esym := Sym{
+			Name: ctx.Dynstr.GetOffset(sym.Name),
+			Info: elfSym.Info,
+			Size: elfSym.Size,
+		}
+
+		if sym.HasCopyrel {
+			// 动态库对该符号的引用也会被解析到复制出来的这份数据上
+			if sym.IsCopyrelReadonly {
+				esym.Shndx = uint16(ctx.CopyrelRelro.Shndx)
+			} else {
+				esym.Shndx = uint16(ctx.Copyrel.Shndx)
+			}
+			esym.Val = sym.GetAddr(ctx)
+		} else if sym.File.IsDso || sym.ElfSym().IsUndef() {
+			esym.Shndx = uint16(elf.SHN_UNDEF)
+			// 动态链接器会把对该函数的引用都解析到这个PLT表项上
+			if sym.IsCanonical {
+				esym.Val = sym.GetPltAddr(ctx)
+			}
+		} else {
+			esym.Shndx = uint16(sym.GetOutputShndx(ctx))
+			esym.Val = sym.GetDefinedAddr(ctx)
+			esym.Other = uint8(sym.Visibility)
+			if elfSym.Type() == uint8(elf.STT_TLS) {
+				esym.Val -= ctx.TpAddr
+			}
+		}
+
+		utils.Write[Sym](base[int(sym.DynsymIdx)*SymSize:], esym)
+	}
+}
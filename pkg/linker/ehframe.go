@@ -0,0 +1,80 @@
+package linker
+
+import (
+	"bytes"
+	"rvld/pkg/utils"
+)
+
+// .eh_frame由CIE和FDE两种记录组成，每个FDE描述一个函数的栈展开信息，并引用一个CIE保存公共的部分。
+// 链接时把输入的.eh_frame拆成记录，丢掉死函数的FDE，合并相同的CIE，再重新生成输出的.eh_frame
+
+type CieRecord struct {
+	File         *ObjectFile
+	InputSection *InputSection
+	InputOffset  uint32
+	RelIdx       uint32
+	RelEnd       uint32
+
+	// 在输出的.eh_frame中的偏移，相同的CIE只输出第一个，其他的指向它
+	Offset   uint32
+	IsLeader bool
+}
+
+func (c *CieRecord) Contents() []byte {
+	return recordContents(c.InputSection.Contents, c.InputOffset)
+}
+
+func (c *CieRecord) Rels() []Rela {
+	return c.InputSection.GetRels()[c.RelIdx:c.RelEnd]
+}
+
+// 内容和重定位都相同的CIE可以合并，重定位比较的是解析后的符号
+func (c *CieRecord) Equals(other *CieRecord) bool {
+	if !bytes.Equal(c.Contents(), other.Contents()) {
+		return false
+	}
+
+	rels1 := c.Rels()
+	rels2 := other.Rels()
+	if len(rels1) != len(rels2) {
+		return false
+	}
+
+	for i := range rels1 {
+		x := rels1[i]
+		y := rels2[i]
+		if x.Offset-uint64(c.InputOffset) != y.Offset-uint64(other.InputOffset) ||
+			x.Type != y.Type || x.Addend != y.Addend ||
+			c.File.Symbols[x.Sym] != other.File.Symbols[y.Sym] {
+			return false
+		}
+	}
+	return true
+}
+
+type FdeRecord struct {
+	InputOffset  uint32
+	OutputOffset uint32
+	RelIdx       uint32
+	RelEnd       uint32
+	CieIdx       uint32
+	IsAlive      bool
+}
+
+func (f *FdeRecord) Cie(file *ObjectFile) *CieRecord {
+	return &file.Cies[f.CieIdx]
+}
+
+func (f *FdeRecord) Contents(file *ObjectFile) []byte {
+	return recordContents(f.Cie(file).InputSection.Contents, f.InputOffset)
+}
+
+// 第一个重定位总是指向函数的起始地址
+func (f *FdeRecord) Rels(file *ObjectFile) []Rela {
+	return f.Cie(file).InputSection.GetRels()[f.RelIdx:f.RelEnd]
+}
+
+func recordContents(data []byte, offset uint32) []byte {
+	size := utils.Read[uint32](data[offset:])
+	return data[offset : offset+4+size]
+}
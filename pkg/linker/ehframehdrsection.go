@@ -0,0 +1,59 @@
+package linker
+
+import (
+	"debug/elf"
+	"rvld/pkg/utils"
+	"sort"
+)
+
+const EhFrameHdrSize = 12
+
+// 按函数地址排序的表，栈展开时用二分查找找到PC所在函数的FDE
+type EhFrameHdrEntry struct {
+	InitAddr uint64
+	FdeAddr  uint64
+}
+
+type EhFrameHdrSection struct {
+	Chunk
+}
+
+func NewEhFrameHdrSection() *EhFrameHdrSection {
+	e := &EhFrameHdrSection{Chunk: NewChunk()}
+	e.Name = ".eh_frame_hdr"
+	e.Shdr.Type = uint32(elf.SHT_PROGBITS)
+	e.Shdr.Flags = uint64(elf.SHF_ALLOC)
+	e.Shdr.AddrAlign = 4
+	return e
+}
+
+func (e *EhFrameHdrSection) UpdateShdr(ctx *Context) {
+	if ctx.EhFrame.Shdr.Size == 0 {
+		e.Shdr.Size = 0
+		return
+	}
+	e.Shdr.Size = EhFrameHdrSize + uint64(ctx.EhFrame.NumFdes)*8
+}
+
+func (e *EhFrameHdrSection) CopyBuf(ctx *Context) {
+	buf := ctx.Buf[e.Shdr.Offset:]
+	buf[0] = 1
+	buf[1] = DW_EH_PE_pcrel | DW_EH_PE_sdata4
+	buf[2] = DW_EH_PE_udata4
+	buf[3] = DW_EH_PE_datarel | DW_EH_PE_sdata4
+	utils.Write[uint32](buf[4:], uint32(ctx.EhFrame.Shdr.Addr-e.Shdr.Addr-4))
+	utils.Write[uint32](buf[8:], ctx.EhFrame.NumFdes)
+}
+
+// 表中的地址都是相对于.eh_frame_hdr的，由.eh_frame在重定位FDE时一起写入
+func (e *EhFrameHdrSection) WriteTable(ctx *Context, entries []EhFrameHdrEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].InitAddr < entries[j].InitAddr
+	})
+
+	buf := ctx.Buf[e.Shdr.Offset+EhFrameHdrSize:]
+	for i, entry := range entries {
+		utils.Write[uint32](buf[i*8:], uint32(entry.InitAddr-e.Shdr.Addr))
+		utils.Write[uint32](buf[i*8+4:], uint32(entry.FdeAddr-e.Shdr.Addr))
+	}
+}
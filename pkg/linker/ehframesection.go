@@ -0,0 +1,171 @@
+package linker
+
+import (
+	"debug/elf"
+	"fmt"
+	"rvld/pkg/utils"
+)
+
+type EhFrameSection struct {
+	Chunk
+	NumFdes uint32
+}
+
+func NewEhFrameSection() *EhFrameSection {
+	e := &EhFrameSection{Chunk: NewChunk()}
+	e.Name = ".eh_frame"
+	e.Shdr.Type = uint32(elf.SHT_PROGBITS)
+	e.Shdr.Flags = uint64(elf.SHF_ALLOC)
+	e.Shdr.AddrAlign = 8
+	return e
+}
+
+func (e *EhFrameSection) Construct(ctx *Context) {
+	for _, file := range ctx.Objs {
+		for _, section := range file.Sections {
+			if section != nil && !section.IsAlive {
+				fdes := section.GetFdes()
+				for i := range fdes {
+					fdes[i].IsAlive = false
+				}
+			}
+		}
+	}
+
+	leaders := make([]*CieRecord, 0)
+	offset := uint32(0)
+	for _, file := range ctx.Objs {
+		for i := range file.Cies {
+			cie := &file.Cies[i]
+			cie.IsLeader = true
+			for _, leader := range leaders {
+				if cie.Equals(leader) {
+					cie.IsLeader = false
+					cie.Offset = leader.Offset
+					break
+				}
+			}
+
+			if cie.IsLeader {
+				cie.Offset = offset
+				offset += uint32(len(cie.Contents()))
+				leaders = append(leaders, cie)
+			}
+		}
+	}
+
+	e.NumFdes = 0
+	for _, file := range ctx.Objs {
+		for i := range file.Fdes {
+			fde := &file.Fdes[i]
+			if fde.IsAlive {
+				fde.OutputOffset = offset
+				offset += uint32(len(fde.Contents(file)))
+				e.NumFdes++
+			}
+		}
+	}
+
+	// 末尾以长度为0的记录结束
+	if offset > 0 {
+		e.Shdr.Size = uint64(offset) + 4
+	}
+}
+
+func (e *EhFrameSection) CopyBuf(ctx *Context) {
+	jobs, finish := e.CopyJobs(ctx)
+	for _, job := range jobs {
+		job()
+	}
+	finish()
+}
+
+// 每个输入文件的CIE和FDE是一个任务，最后写入终止记录和.eh_frame_hdr中的查找表
+func (e *EhFrameSection) CopyJobs(ctx *Context) ([]func(), func()) {
+	base := ctx.Buf[e.Shdr.Offset:]
+	entries := make([][]EhFrameHdrEntry, len(ctx.Objs))
+
+	jobs := make([]func(), len(ctx.Objs))
+	for i, file := range ctx.Objs {
+		jobs[i] = func() {
+			for j := range file.Cies {
+				cie := &file.Cies[j]
+				if !cie.IsLeader {
+					continue
+				}
+
+				copy(base[cie.Offset:], cie.Contents())
+				for _, rel := range cie.Rels() {
+					e.applyReloc(ctx, file, rel, cie.Offset+uint32(rel.Offset)-cie.InputOffset)
+				}
+			}
+
+			for j := range file.Fdes {
+				fde := &file.Fdes[j]
+				if !fde.IsAlive {
+					continue
+				}
+
+				// CIE指针是从这个字段到所属CIE的距离，合并CIE后要重新计算
+				copy(base[fde.OutputOffset:], fde.Contents(file))
+				utils.Write[uint32](base[fde.OutputOffset+4:], fde.OutputOffset+4-fde.Cie(file).Offset)
+
+				rels := fde.Rels(file)
+				for _, rel := range rels {
+					e.applyReloc(ctx, file, rel, fde.OutputOffset+uint32(rel.Offset)-fde.InputOffset)
+				}
+
+				if ctx.EhFrameHdr != nil {
+					sym := file.Symbols[rels[0].Sym]
+					entries[i] = append(entries[i], EhFrameHdrEntry{
+						InitAddr: sym.GetAddr(ctx) + uint64(rels[0].Addend),
+						FdeAddr:  e.Shdr.Addr + uint64(fde.OutputOffset),
+					})
+				}
+			}
+		}
+	}
+
+	finish := func() {
+		utils.Write[uint32](base[e.Shdr.Size-4:], 0)
+
+		if ctx.EhFrameHdr != nil {
+			all := make([]EhFrameHdrEntry, 0, e.NumFdes)
+			for _, v := range entries {
+				all = append(all, v...)
+			}
+			ctx.EhFrameHdr.WriteTable(ctx, all)
+		}
+	}
+	return jobs, finish
+}
+
+func (e *EhFrameSection) applyReloc(ctx *Context, file *ObjectFile, rel Rela, offset uint32) {
+	if rel.Type == uint32(elf.R_RISCV_NONE) || rel.Type == uint32(elf.R_RISCV_RELAX) {
+		return
+	}
+
+	sym := file.Symbols[rel.Sym]
+	loc := ctx.Buf[e.Shdr.Offset+uint64(offset):]
+	val := sym.GetAddr(ctx) + uint64(rel.Addend)
+
+	switch rel.Type {
+	case uint32(elf.R_RISCV_32_PCREL):
+		utils.Write[uint32](loc, uint32(val-e.Shdr.Addr-uint64(offset)))
+	case uint32(elf.R_RISCV_32):
+		utils.Write[uint32](loc, uint32(val))
+	case uint32(elf.R_RISCV_64):
+		utils.Write[uint64](loc, val)
+	default:
+		known, err := applyLabelDiff(loc, rel.Type, val)
+		if !known {
+			utils.Fatal(&InputError{
+				File: file.File,
+				Msg:  fmt.Sprintf(".eh_frame: invalid relocation %v", elf.R_RISCV(rel.Type)),
+			})
+		}
+		if err != nil {
+			ctx.Diag.Error(&InputError{File: file.File, Msg: ".eh_frame: " + err.Error()})
+		}
+	}
+}
@@ -13,12 +13,43 @@ const IMAGE_BASE uint64 = 0x200000
 const EF_RISCV_RVC uint32 = 1
 const PageSize = 4096
 
+// RISC-V的DTV中的指针指向TLS块的起始地址再加上0x800
+const TlsDtvOffset = 0x800
+
 const EhdrSize = int(unsafe.Sizeof(Ehdr{}))
 const ShdrSize = int(unsafe.Sizeof(Shdr{}))
 const PhdrSize = int(unsafe.Sizeof(Phdr{}))
 const SymSize = int(unsafe.Sizeof(Sym{}))
 const ArHdrSize = int(unsafe.Sizeof(ArHdr{}))
 const RelaSize = int(unsafe.Sizeof(Rela{}))
+const DynSize = int(unsafe.Sizeof(Dyn{}))
+const VerdefSize = int(unsafe.Sizeof(Verdef{}))
+const VerdauxSize = int(unsafe.Sizeof(Verdaux{}))
+const VerneedSize = int(unsafe.Sizeof(Verneed{}))
+const VernauxSize = int(unsafe.Sizeof(Vernaux{}))
+const ChdrSize = int(unsafe.Sizeof(Chdr{}))
+
+const R_RISCV_IRELATIVE uint32 = 58
+const R_RISCV_SET_ULEB128 uint32 = 60
+const R_RISCV_SUB_ULEB128 uint32 = 61
+const STT_GNU_IFUNC uint8 = 10
+
+const SHT_RELR uint32 = 19
+const SHT_RISCV_ATTRIBUTES uint32 = 0x70000003
+const SHT_LLVM_ADDRSIG uint32 = 0x6fff4c03
+const DT_RELRSZ = 35
+const DT_RELR = 36
+const DT_RELRENT = 37
+
+const DW_EH_PE_udata4 = 0x03
+const DW_EH_PE_sdata4 = 0x0b
+const DW_EH_PE_pcrel = 0x10
+const DW_EH_PE_datarel = 0x30
+
+const VER_NDX_LOCAL uint16 = 0
+const VER_NDX_GLOBAL uint16 = 1
+const VERSYM_HIDDEN uint16 = 0x8000
+const VER_FLG_BASE uint16 = 1
 
 type Ehdr struct {
 	Ident     [16]uint8
@@ -77,6 +108,49 @@ type Rela struct {
 	Addend int64
 }
 
+type Dyn struct {
+	Tag int64
+	Val uint64
+}
+
+type Chdr struct {
+	Type      uint32
+	Reserved  uint32
+	Size      uint64
+	AddrAlign uint64
+}
+
+type Verdef struct {
+	Version uint16
+	Flags   uint16
+	Ndx     uint16
+	Cnt     uint16
+	Hash    uint32
+	Aux     uint32
+	Next    uint32
+}
+
+type Verdaux struct {
+	Name uint32
+	Next uint32
+}
+
+type Verneed struct {
+	Version uint16
+	Cnt     uint16
+	File    uint32
+	Aux     uint32
+	Next    uint32
+}
+
+type Vernaux struct {
+	Hash  uint32
+	Flags uint16
+	Other uint16
+	Name  uint32
+	Next  uint32
+}
+
 type ArHdr struct {
 	Name [16]byte
 	Date [12]byte
@@ -136,3 +210,11 @@ func (s *Sym) IsUndef() bool {
 func (s *Sym) IsCommon() bool {
 	return s.Shndx == uint16(elf.SHN_COMMON)
 }
+
+func (s *Sym) Type() uint8 {
+	return s.Info & 0xf
+}
+
+func (s *Sym) IsWeak() bool {
+	return elf.ST_BIND(s.Info) == elf.STB_WEAK
+}
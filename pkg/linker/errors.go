@@ -0,0 +1,213 @@
+package linker
+
+import (
+	"debug/elf"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"rvld/pkg/utils"
+	"strings"
+	"sync"
+)
+
+type UndefinedSymbolError struct {
+	Name string
+	// 引用了这个符号的文件
+	Files []*File
+}
+
+func (e *UndefinedSymbolError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "undefined symbol: %s", e.Name)
+	for _, file := range e.Files {
+		fmt.Fprintf(&b, "\n>>> referenced by %s", file)
+	}
+	return b.String()
+}
+
+type DuplicateSymbolError struct {
+	Name   string
+	First  *File
+	Second *File
+}
+
+func (e *DuplicateSymbolError) Error() string {
+	return fmt.Sprintf("duplicate symbol: %s\n>>> defined in %s\n>>> defined in %s",
+		e.Name, e.First, e.Second)
+}
+
+// 输入文件的格式不正确
+type InputError struct {
+	File *File
+	Msg  string
+}
+
+func (e *InputError) Error() string {
+	return fmt.Sprintf("%s: %s", e.File, e.Msg)
+}
+
+type RelocationOverflowError struct {
+	File    *File
+	Section string
+	Offset  uint64
+	Type    elf.R_RISCV
+	Symbol  string
+	Val     int64
+	Min     int64
+	Max     int64
+}
+
+func (e *RelocationOverflowError) Error() string {
+	return fmt.Sprintf("%s:(%s+0x%x): relocation %v against `%s' out of range: "+
+		"%d is not in [%d, %d)", e.File, e.Section, e.Offset, e.Type, e.Symbol,
+		e.Val, e.Min, e.Max)
+}
+
+// 超过--error-limit时用来中止链接
+var errTooManyErrors = errors.New("too many errors emitted, stopping now " +
+	"(use --error-limit=0 to see all errors)")
+
+// 有错误时在阶段之间中止链接，错误本身已经记录在Diagnostics中
+var errAborted = errors.New("link aborted")
+
+// 收集链接过程中的错误和警告，可以被多个线程同时使用
+type Diagnostics struct {
+	mu       sync.Mutex
+	Errors   []error
+	Warnings []string
+	// 最多报告多少个错误，0表示不限制
+	Limit int
+	// 致命错误时是否打印调用栈
+	PrintStack bool
+	Out        io.Writer
+	// 是否用颜色标出错误和警告，默认只在输出到终端时使用
+	Color    bool
+	cleanups []func()
+}
+
+func NewDiagnostics() *Diagnostics {
+	return &Diagnostics{
+		Limit: 20,
+		Out:   os.Stderr,
+		Color: utils.IsTerminal(os.Stderr),
+	}
+}
+
+func (d *Diagnostics) label(color string, label string) string {
+	if d.Color {
+		return "\033[0;1;" + color + "m" + label + ":\033[0m"
+	}
+	return label + ":"
+}
+
+// 报告一个错误但继续链接，以便一次报告尽可能多的错误
+func (d *Diagnostics) Error(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.Errors = append(d.Errors, err)
+	fmt.Fprintf(d.Out, "rvld: %s %v\n", d.label("31", "error"), err)
+
+	if d.Limit > 0 && len(d.Errors) >= d.Limit {
+		fmt.Fprintf(d.Out, "rvld: %v\n", errTooManyErrors)
+		panic(errTooManyErrors)
+	}
+}
+
+func (d *Diagnostics) Warn(msg string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.Warnings = append(d.Warnings, msg)
+	fmt.Fprintf(d.Out, "rvld: %s %s\n", d.label("35", "warning"), msg)
+}
+
+func (d *Diagnostics) HasErrors() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.Errors) > 0
+}
+
+// 前面的阶段出过错时不再继续执行后面的阶段
+func (d *Diagnostics) Checkpoint() {
+	if d.HasErrors() {
+		panic(errAborted)
+	}
+}
+
+// 链接失败时要执行的清理工作，例如删除写了一半的输出文件
+func (d *Diagnostics) AddCleanup(fn func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.cleanups = append(d.cleanups, fn)
+}
+
+func (d *Diagnostics) fatal(e *utils.FatalError) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.Errors = append(d.Errors, e.Err)
+	fmt.Fprintf(d.Out, "rvld: %s %v\n", d.label("31", "fatal"), e.Err)
+	if d.PrintStack {
+		d.Out.Write(e.Stack)
+	}
+}
+
+// SetPanicOnFault产生的panic带有出错的地址，落在某个映射的文件中时说明文件在链接过程中被截断了
+func mappedFileError(ctx *Context, e runtime.Error) error {
+	fault, ok := e.(interface{ Addr() uintptr })
+	if !ok {
+		return nil
+	}
+	if name, ok := ctx.Mappings.Find(fault.Addr()); ok {
+		return fmt.Errorf("%s: file was truncated while being linked", name)
+	}
+	return nil
+}
+
+// 执行fn，出错时不退出进程，而是返回收集到的所有错误
+func Run(ctx *Context, fn func()) (err error) {
+	// 映射到内存中的文件被其他进程截断时，访问它会产生SIGBUS，让它变成可以恢复的panic
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer ctx.Mappings.UnmapInputFiles()
+
+	defer func() {
+		if r := recover(); r != nil {
+			switch e := r.(type) {
+			case *utils.FatalError:
+				ctx.Diag.fatal(e)
+			case runtime.Error:
+				if err := mappedFileError(ctx, e); err != nil {
+					ctx.Diag.fatal(&utils.FatalError{Err: err})
+					break
+				}
+				ctx.Diag.fatal(&utils.FatalError{
+					Err:   fmt.Errorf("internal error: %w", e),
+					Stack: debug.Stack(),
+				})
+			case error:
+				if e != errTooManyErrors && e != errAborted {
+					ctx.Diag.fatal(&utils.FatalError{Err: e, Stack: debug.Stack()})
+				}
+			default:
+				ctx.Diag.fatal(&utils.FatalError{
+					Err:   fmt.Errorf("internal error: %v", r),
+					Stack: debug.Stack(),
+				})
+			}
+		}
+
+		if ctx.Diag.HasErrors() {
+			for _, fn := range ctx.Diag.cleanups {
+				fn()
+			}
+			err = errors.Join(ctx.Diag.Errors...)
+		}
+	}()
+
+	fn()
+	return nil
+}
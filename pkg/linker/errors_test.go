@@ -0,0 +1,54 @@
+package linker
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var faultSink byte
+
+// 输入文件映射到内存之后被截断，访问它时的SIGBUS要作为普通的错误报告
+func TestTruncatedInputFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.o")
+	if err := os.WriteFile(path, make([]byte, 1<<16), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	ctx := NewContext()
+	ctx.Diag.Out = &out
+	ctx.Diag.Color = false
+	err := Run(ctx, func() {
+		file := MustNewFile(ctx, path)
+		if err := os.Truncate(path, 0); err != nil {
+			t.Fatal(err)
+		}
+		faultSink = file.Contents[len(file.Contents)-1]
+	})
+	if err == nil || !strings.Contains(out.String(), path+": file was truncated while being linked") {
+		t.Errorf("unexpected result %v:\n%s", err, out.String())
+	}
+}
+
+// 一次链接结束时只释放它自己映射的文件，不影响同一进程中的其他链接
+func TestUnmapOnlyOwnFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.o")
+	if err := os.WriteFile(path, bytes.Repeat([]byte{1}, 1<<12), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	other := NewContext()
+	defer other.Mappings.UnmapInputFiles()
+	file := MustNewFile(other, path)
+
+	ctx := NewContext()
+	if err := Run(ctx, func() { MustNewFile(ctx, path) }); err != nil {
+		t.Fatal(err)
+	}
+	if file.Contents[len(file.Contents)-1] != 1 {
+		t.Errorf("unexpected contents of %s", path)
+	}
+}
@@ -1,8 +1,11 @@
 package linker
 
 import (
+	"fmt"
+	"io"
 	"os"
 	"rvld/pkg/utils"
+	"strings"
 )
 
 type File struct {
@@ -11,35 +14,146 @@ type File struct {
 	Parent   *File
 }
 
-func MustNewFile(filename string) *File {
-	contents, err := os.ReadFile(filename)
+func (f *File) String() string {
+	if f.Parent != nil {
+		return fmt.Sprintf("%s(%s)", f.Parent.Name, f.Name)
+	}
+	return f.Name
+}
+
+func MustNewFile(ctx *Context, filename string) *File {
+	file, err := openFile(ctx, filename)
 	utils.MustNo(err)
-	return &File{
+	return file
+}
+
+func OpenLibrary(ctx *Context, filepath string) *File {
+	file, err := openFile(ctx, filepath)
+	if err != nil {
+		return nil
+	}
+	return file
+}
+
+// 同一个文件只映射一次，例如确定目标架构时读过的输入文件在读取输入文件时直接复用
+func openFile(ctx *Context, filename string) (*File, error) {
+	if file, ok := ctx.Files[filename]; ok {
+		return file, nil
+	}
+
+	contents, err := readFile(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &File{
 		Name:     filename,
 		Contents: contents,
 	}
+	ctx.Files[filename] = file
+	return file, nil
 }
 
-func OpenLibrary(filepath string) *File {
-	contents, err := os.ReadFile(filepath)
+// 输入文件只读地映射到内存中，不支持mmap的文件系统上退回到整个读进来
+func readFile(ctx *Context, filename string) ([]byte, error) {
+	f, err := os.Open(filename)
 	if err != nil {
-		return nil
+		return nil, err
 	}
+	defer f.Close()
 
-	return &File{
-		Name:     filepath,
-		Contents: contents,
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if st.Mode().IsRegular() && st.Size() > 0 {
+		if contents, err := ctx.Mappings.Mmap(f, int(st.Size()), false); err == nil {
+			return contents, nil
+		}
+	}
+
+	return io.ReadAll(f)
+}
+
+// 和riscv64-linux-gnu的GNU ld一样的默认搜索路径，都相对于--sysroot
+var DefaultLibraryPaths = []string{
+	"=/usr/local/lib/riscv64-linux-gnu",
+	"=/lib/riscv64-linux-gnu",
+	"=/usr/lib/riscv64-linux-gnu",
+	"=/usr/local/lib64",
+	"=/lib64",
+	"=/usr/lib64",
+	"=/usr/local/lib",
+	"=/lib",
+	"=/usr/lib",
+	"=/usr/riscv64-linux-gnu/lib64",
+	"=/usr/riscv64-linux-gnu/lib",
+}
+
+// 以=或$SYSROOT开头的路径相对于--sysroot
+func ResolveSysrootPath(ctx *Context, path string) string {
+	if rest, ok := utils.RemovePrefix(path, "="); ok {
+		return ctx.Args.Sysroot + rest
 	}
+	if rest, ok := utils.RemovePrefix(path, "$SYSROOT"); ok {
+		return ctx.Args.Sysroot + rest
+	}
+	return path
 }
 
+// 默认搜索路径中可能有其他架构的库，和GNU ld一样跳过它们
+func isCompatibleLibrary(ctx *Context, file *File) bool {
+	switch GetFileType(file.Contents) {
+	case FileTypeObject, FileTypeDso:
+		return GetMachineTypeFromContents(file.Contents) == ctx.Args.Emulation
+	case FileTypeArchive:
+		for _, member := range ReadArchiveMembers(file) {
+			if GetFileType(member.Contents) == FileTypeObject {
+				return GetMachineTypeFromContents(member.Contents) == ctx.Args.Emulation
+			}
+		}
+	}
+	return true
+}
+
+// -lfoo依次尝试libfoo.so和libfoo.a，-l:foo只尝试文件名foo
 func FindLibrary(ctx *Context, name string) *File {
+	var filenames []string
+	if filename, ok := utils.RemovePrefix(name, ":"); ok {
+		filenames = []string{filename}
+	} else {
+		if !ctx.Reader.IsStatic {
+			filenames = append(filenames, "lib"+name+".so")
+		}
+		filenames = append(filenames, "lib"+name+".a")
+	}
+
+	tried := make([]string, 0)
 	for _, dir := range ctx.Args.LibraryPaths {
-		filepath := dir + "/lib" + name + ".a"
-		if f := OpenLibrary(filepath); f != nil {
-			return f
+		for _, filename := range filenames {
+			path := dir + "/" + filename
+			f := OpenLibrary(ctx, path)
+			if f == nil {
+				tried = append(tried, path)
+				continue
+			}
+
+			if isCompatibleLibrary(ctx, f) {
+				return f
+			}
+			tried = append(tried, path+" (skipped incompatible)")
 		}
 	}
 
-	utils.Fatal("library not found")
+	var b strings.Builder
+	fmt.Fprintf(&b, "library not found: -l%s", name)
+	if len(tried) == 0 {
+		b.WriteString("\n>>> no library search paths were given with -L")
+	}
+	for _, path := range tried {
+		fmt.Fprintf(&b, "\n>>> tried %s", path)
+	}
+	utils.Fatal(b.String())
 	return nil
 }
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"debug/elf"
 	"rvld/pkg/utils"
+	"unicode"
 )
 
 type FileType = uint8
@@ -13,6 +14,8 @@ const (
 	FileTypeEmpty   FileType = iota
 	FileTypeObject  FileType = iota
 	FileTypeArchive FileType = iota
+	FileTypeDso     FileType = iota
+	FileTypeText    FileType = iota
 )
 
 func GetFileType(contents []byte) FileType {
@@ -25,6 +28,8 @@ func GetFileType(contents []byte) FileType {
 		switch elfType {
 		case elf.ET_REL:
 			return FileTypeObject
+		case elf.ET_DYN:
+			return FileTypeDso
 		}
 
 		return FileTypeUnknown
@@ -34,12 +39,30 @@ func GetFileType(contents []byte) FileType {
 		return FileTypeArchive
 	}
 
+	// 像glibc的libc.so这样的文件实际上是链接脚本
+	if isTextFile(contents) {
+		return FileTypeText
+	}
+
 	return FileTypeUnknown
 }
 
 func CheckFileCompatibility(ctx *Context, file *File) {
 	machineType := GetMachineTypeFromContents(file.Contents)
 	if machineType != ctx.Args.Emulation {
-		utils.Fatal("incompatible file type")
+		utils.Fatal(&InputError{File: file, Msg: "incompatible file type"})
+	}
+}
+
+func isTextFile(contents []byte) bool {
+	if len(contents) < 4 {
+		return false
+	}
+
+	for _, c := range contents[:4] {
+		if !unicode.IsPrint(rune(c)) && !unicode.IsSpace(rune(c)) {
+			return false
+		}
 	}
+	return true
 }
@@ -0,0 +1,39 @@
+package linker
+
+import (
+	"debug/elf"
+	"rvld/pkg/utils"
+)
+
+// 前两项由动态链接器填入_dl_runtime_resolve和link_map
+const GotPltHdrSize uint64 = 16
+
+type GotPltSection struct {
+	Chunk
+}
+
+func NewGotPltSection() *GotPltSection {
+	g := &GotPltSection{Chunk: NewChunk()}
+	g.Name = ".got.plt"
+	g.Shdr.Type = uint32(elf.SHT_PROGBITS)
+	g.Shdr.Flags = uint64(elf.SHF_ALLOC | elf.SHF_WRITE)
+	g.Shdr.AddrAlign = 8
+	return g
+}
+
+func (g *GotPltSection) UpdateShdr(ctx *Context) {
+	if len(ctx.Plt.Symbols) == 0 {
+		g.Shdr.Size = 0
+		return
+	}
+	g.Shdr.Size = GotPltHdrSize + uint64(len(ctx.Plt.Symbols))*8
+}
+
+func (g *GotPltSection) CopyBuf(ctx *Context) {
+	base := ctx.Buf[g.Shdr.Offset:]
+
+	// 延迟绑定时，第一次调用会跳转到PLT的头部去解析符号
+	for _, sym := range ctx.Plt.Symbols {
+		utils.Write[uint64](base[GotPltHdrSize+uint64(sym.PltIdx)*8:], ctx.Plt.Shdr.Addr)
+	}
+}
@@ -7,7 +7,10 @@ import (
 
 type GotSection struct {
 	Chunk
+	GotSyms   []*Symbol
 	GotTpSyms []*Symbol
+	TlsGdSyms []*Symbol
+	IpltSyms  []*Symbol
 }
 
 func NewGotSection() *GotSection {
@@ -15,13 +18,21 @@ func NewGotSection() *GotSection {
 	g.Name = ".got"
 	g.Shdr.Type = uint32(elf.SHT_PROGBITS)
 	g.Shdr.Flags = uint64(elf.SHF_ALLOC | elf.SHF_WRITE)
-	g.Shdr.AddrAlign = 0
+	g.Shdr.AddrAlign = 8
 	return g
 }
 
 type GotEntry struct {
-	Idx int64
-	Val uint64
+	Idx   int64
+	Val   uint64
+	RType uint32
+	Sym   *Symbol
+}
+
+func (g *GotSection) AddGotSymbol(sym *Symbol) {
+	sym.GotIdx = int32(g.Shdr.Size / 8)
+	g.Shdr.Size += 8
+	g.GotSyms = append(g.GotSyms, sym)
 }
 
 func (g *GotSection) AddGotTpSymbol(sym *Symbol) {
@@ -30,21 +41,150 @@ func (g *GotSection) AddGotTpSymbol(sym *Symbol) {
 	g.GotTpSyms = append(g.GotTpSyms, sym)
 }
 
+// General Dynamic模型需要两个连续的表项，分别是模块ID和变量在模块TLS块中的偏移
+func (g *GotSection) AddTlsGdSymbol(sym *Symbol) {
+	sym.TlsGdIdx = int32(g.Shdr.Size / 8)
+	g.Shdr.Size += 16
+	g.TlsGdSyms = append(g.TlsGdSyms, sym)
+}
+
+func (g *GotSection) AddIpltSymbol(sym *Symbol) {
+	sym.IpltGotIdx = int32(g.Shdr.Size / 8)
+	g.Shdr.Size += 8
+	g.IpltSyms = append(g.IpltSyms, sym)
+}
+
 func (g *GotSection) GetEntries(ctx *Context) []GotEntry {
 	entries := make([]GotEntry, 0)
+	for _, sym := range g.GotSyms {
+		idx := sym.GotIdx
+		// 动态库中的符号的地址要等到运行时由动态链接器填入
+		if sym.IsImported {
+			entries = append(entries, GotEntry{
+				Idx:   int64(idx),
+				RType: uint32(elf.R_RISCV_64),
+				Sym:   sym,
+			})
+			continue
+		}
+
+		// 位置无关的输出文件中，本地符号的地址需要加上加载基址
+		if ctx.Args.IsPic() && getSymbolKind(ctx, sym) == 1 {
+			entries = append(entries, GotEntry{
+				Idx:   int64(idx),
+				Val:   sym.GetAddr(ctx),
+				RType: uint32(elf.R_RISCV_RELATIVE),
+			})
+			continue
+		}
+
+		entries = append(entries, GotEntry{
+			Idx: int64(idx),
+			Val: sym.GetAddr(ctx),
+		})
+	}
+
 	for _, sym := range g.GotTpSyms {
 		idx := sym.GotTpIdx
+		if sym.IsImported {
+			entries = append(entries, GotEntry{
+				Idx:   int64(idx),
+				RType: uint32(elf.R_RISCV_TLS_TPREL64),
+				Sym:   sym,
+			})
+			continue
+		}
+
+		// 动态库的TLS块相对于线程指针的位置要到运行时才能确定
+		if ctx.Args.Shared {
+			entries = append(entries, GotEntry{
+				Idx:   int64(idx),
+				Val:   sym.GetAddr(ctx) - ctx.TpAddr,
+				RType: uint32(elf.R_RISCV_TLS_TPREL64),
+			})
+			continue
+		}
+
 		entries = append(entries, GotEntry{
 			Idx: int64(idx),
-			Val: sym.GetAddr() - ctx.TpAddr,
+			Val: sym.GetAddr(ctx) - ctx.TpAddr,
+		})
+	}
+
+	// RISC-V的DTV指针指向TLS块起始处往后TlsDtvOffset字节的位置
+	dtpAddr := ctx.TpAddr + TlsDtvOffset
+	for _, sym := range g.TlsGdSyms {
+		idx := int64(sym.TlsGdIdx)
+		if sym.IsImported {
+			entries = append(entries,
+				GotEntry{Idx: idx, RType: uint32(elf.R_RISCV_TLS_DTPMOD64), Sym: sym},
+				GotEntry{Idx: idx + 1, RType: uint32(elf.R_RISCV_TLS_DTPREL64), Sym: sym})
+			continue
+		}
+
+		// 动态库的模块ID由动态链接器分配，可执行文件的模块ID固定为1
+		if ctx.Args.Shared {
+			entries = append(entries,
+				GotEntry{Idx: idx, RType: uint32(elf.R_RISCV_TLS_DTPMOD64)})
+		} else {
+			entries = append(entries, GotEntry{Idx: idx, Val: 1})
+		}
+		entries = append(entries, GotEntry{Idx: idx + 1, Val: sym.GetAddr(ctx) - dtpAddr})
+	}
+
+	// 在程序启动时会被IRELATIVE重定位改写为解析函数的返回值
+	for _, sym := range g.IpltSyms {
+		entries = append(entries, GotEntry{
+			Idx: int64(sym.IpltGotIdx),
+			Val: sym.GetDefinedAddr(ctx),
 		})
 	}
 	return entries
 }
 
+func (e *GotEntry) IsRelr(ctx *Context) bool {
+	return e.RType == uint32(elf.R_RISCV_RELATIVE) && ctx.Args.PackDynRelocsRelr
+}
+
+func (e *GotEntry) NeedsRela(ctx *Context) bool {
+	return e.RType != uint32(elf.R_RISCV_NONE) && !e.IsRelr(ctx)
+}
+
+func (g *GotSection) GetNumDynrels(ctx *Context) int {
+	n := 0
+	for _, entry := range g.GetEntries(ctx) {
+		if entry.NeedsRela(ctx) {
+			n++
+		}
+	}
+	return n
+}
+
 func (g *GotSection) CopyBuf(ctx *Context) {
 	base := ctx.Buf[g.Shdr.Offset:]
+	var relDyn []byte
+	if ctx.RelDyn != nil {
+		relDyn = ctx.Buf[ctx.RelDyn.Shdr.Offset:]
+	}
+
 	for _, entry := range g.GetEntries(ctx) {
+		if entry.NeedsRela(ctx) {
+			rel := Rela{
+				Offset: g.Shdr.Addr + uint64(entry.Idx)*8,
+				Type:   entry.RType,
+			}
+
+			// 本地符号的表项不引用动态符号，值通过加数传给动态链接器
+			if entry.Sym != nil {
+				rel.Sym = uint32(entry.Sym.DynsymIdx)
+			} else {
+				rel.Addend = int64(entry.Val)
+			}
+
+			utils.Write[Rela](relDyn, rel)
+			relDyn = relDyn[RelaSize:]
+		}
+
 		utils.Write(base[entry.Idx*8:], entry.Val)
 	}
 }
@@ -0,0 +1,66 @@
+package linker
+
+import (
+	"debug/elf"
+	"rvld/pkg/utils"
+)
+
+// -r时原样保留输入文件中的段组，去掉重复的段组是之后的链接的事情
+type GroupSection struct {
+	Chunk
+	File *ObjectFile
+	// 签名符号在输入文件中的下标
+	SymIdx     uint32
+	GroupFlags uint32
+	Members    []*InputSection
+}
+
+func NewGroupSection(file *ObjectFile, shdr *Shdr) *GroupSection {
+	g := &GroupSection{Chunk: NewChunk(), File: file, SymIdx: shdr.Info}
+	g.Name = ".group"
+	g.Shdr.Type = uint32(elf.SHT_GROUP)
+	g.Shdr.EntSize = 4
+	g.Shdr.AddrAlign = 4
+
+	entries := utils.ReadSlice[uint32](file.GetBytesFromShdr(shdr), 4)
+	if len(entries) == 0 || int(shdr.Info) >= len(file.ElfSyms) {
+		utils.Fatal(&InputError{File: file.File, Msg: "invalid section group"})
+	}
+	g.GroupFlags = entries[0]
+
+	// 输入段的.rela段不是InputSection，它们会跟着输出段的.rela段一起加入段组
+	for _, shndx := range entries[1:] {
+		if shndx >= uint32(len(file.Sections)) {
+			utils.Fatal(&InputError{File: file.File, Msg: "invalid section group member"})
+		}
+		if section := file.Sections[shndx]; section != nil && section.IsAlive {
+			g.Members = append(g.Members, section)
+		}
+	}
+	return g
+}
+
+func (g *GroupSection) UpdateShdr(ctx *Context) {
+	n := 1
+	for _, member := range g.Members {
+		n++
+		if member.OutputSection.Rela != nil {
+			n++
+		}
+	}
+
+	g.Shdr.Size = uint64(n) * 4
+	g.Shdr.Link = uint32(ctx.Symtab.Shndx)
+	g.Shdr.Info = g.File.OutputSymIndices[g.SymIdx]
+}
+
+func (g *GroupSection) CopyBuf(ctx *Context) {
+	entries := []uint32{g.GroupFlags}
+	for _, member := range g.Members {
+		entries = append(entries, uint32(member.OutputSection.Shndx))
+		if rela := member.OutputSection.Rela; rela != nil {
+			entries = append(entries, uint32(rela.Shndx))
+		}
+	}
+	utils.Write[[]uint32](ctx.Buf[g.Shdr.Offset:], entries)
+}
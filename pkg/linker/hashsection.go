@@ -0,0 +1,60 @@
+package linker
+
+import (
+	"debug/elf"
+	"rvld/pkg/utils"
+)
+
+type HashSection struct {
+	Chunk
+}
+
+func NewHashSection() *HashSection {
+	h := &HashSection{Chunk: NewChunk()}
+	h.Name = ".hash"
+	h.Shdr.Type = uint32(elf.SHT_HASH)
+	h.Shdr.Flags = uint64(elf.SHF_ALLOC)
+	h.Shdr.EntSize = 4
+	h.Shdr.AddrAlign = 4
+	return h
+}
+
+func (h *HashSection) UpdateShdr(ctx *Context) {
+	// nbucket和nchain都等于动态符号的个数
+	num := uint64(len(ctx.Dynsym.Symbols)) + 1
+	h.Shdr.Size = (2 + num*2) * 4
+	h.Shdr.Link = uint32(ctx.Dynsym.Shndx)
+}
+
+func (h *HashSection) CopyBuf(ctx *Context) {
+	base := ctx.Buf[h.Shdr.Offset:]
+	num := uint32(len(ctx.Dynsym.Symbols)) + 1
+
+	hdr := make([]uint32, 2+num*2)
+	hdr[0] = num
+	hdr[1] = num
+	buckets := hdr[2 : 2+num]
+	chains := hdr[2+num:]
+
+	for _, sym := range ctx.Dynsym.Symbols {
+		idx := uint32(sym.DynsymIdx)
+		h := elfHash(sym.Name) % num
+		chains[idx] = buckets[h]
+		buckets[h] = idx
+	}
+
+	utils.Write(base, hdr)
+}
+
+func elfHash(name string) uint32 {
+	h := uint32(0)
+	for i := 0; i < len(name); i++ {
+		h = (h << 4) + uint32(name[i])
+		g := h & 0xf0000000
+		if g != 0 {
+			h ^= g >> 24
+		}
+		h &^= g
+	}
+	return h
+}
@@ -1,36 +1,124 @@
 package linker
 
-import "rvld/pkg/utils"
+import (
+	"fmt"
+	"rvld/pkg/utils"
+)
+
+// 读取输入文件时，与位置相关的命令行选项的状态
+type ReaderContext struct {
+	InGroup      bool
+	WholeArchive bool
+	IsStatic     bool
+	AsNeeded     bool
+	Position     int
+}
 
 func ReadInputFiles(ctx *Context, args []string) {
 	for _, arg := range args {
 		var ok bool
-		if arg, ok = utils.RemovePrefix(arg, "-l"); ok {
+		if arg == "--start-group" {
+			if ctx.Reader.InGroup {
+				utils.Fatal("nested --start-group is not allowed")
+			}
+			ctx.Reader.InGroup = true
+		} else if arg == "--end-group" {
+			if !ctx.Reader.InGroup {
+				utils.Fatal("--end-group without --start-group")
+			}
+			ctx.Reader.InGroup = false
+			ctx.Reader.Position++
+		} else if arg == "--whole-archive" {
+			ctx.Reader.WholeArchive = true
+		} else if arg == "--no-whole-archive" {
+			ctx.Reader.WholeArchive = false
+		} else if arg == "--as-needed" {
+			ctx.Reader.AsNeeded = true
+		} else if arg == "--no-as-needed" {
+			ctx.Reader.AsNeeded = false
+		} else if arg == "-Bstatic" {
+			ctx.Reader.IsStatic = true
+		} else if arg == "-Bdynamic" {
+			ctx.Reader.IsStatic = false
+		} else if arg, ok = utils.RemovePrefix(arg, "-l"); ok {
 			ReadFile(ctx, FindLibrary(ctx, arg))
 		} else {
-			ReadFile(ctx, MustNewFile(arg))
+			ReadFile(ctx, MustNewFile(ctx, arg))
 		}
 	}
+
+	if ctx.Reader.InGroup {
+		utils.Fatal("missing --end-group")
+	}
+
+	// 各个文件的解析互不依赖，只有符号表是共享的
+	utils.ParallelFor(ctx.Args.Threads, len(ctx.Objs), func(i int) {
+		ctx.Objs[i].Parse(ctx)
+	})
+	utils.ParallelFor(ctx.Args.Threads, len(ctx.Dsos), func(i int) {
+		ctx.Dsos[i].Parse(ctx)
+	})
+
+	for _, obj := range ctx.Objs {
+		obj.AssignOutputSections(ctx)
+	}
 }
 
 func ReadFile(ctx *Context, file *File) {
 	fileType := GetFileType(file.Contents)
 	switch fileType {
 	case FileTypeObject:
+		TraceFile(ctx, file)
 		ctx.Objs = append(ctx.Objs, CreateObjectFile(ctx, file, false))
 	case FileTypeArchive:
 		for _, child := range ReadArchiveMembers(file) {
 			utils.Assert(GetFileType(child.Contents) == FileTypeObject)
-			ctx.Objs = append(ctx.Objs, CreateObjectFile(ctx, child, true))
+			// --whole-archive区域内的归档成员和普通的目标文件一样作为根存活
+			if ctx.Reader.WholeArchive {
+				TraceFile(ctx, child)
+			}
+			ctx.Objs = append(ctx.Objs,
+				CreateObjectFile(ctx, child, !ctx.Reader.WholeArchive))
+		}
+	case FileTypeDso:
+		if ctx.Args.IsStatic || ctx.Args.Relocatable {
+			utils.Fatal(fmt.Sprintf("attempted static link of dynamic object %s", file))
 		}
+		TraceFile(ctx, file)
+		dso := CreateSharedFile(ctx, file)
+		ctx.Dsos = append(ctx.Dsos, dso)
+		ctx.DsoMap[&dso.InputFile] = dso
+	case FileTypeText:
+		ParseLinkerScript(ctx, file)
 	default:
-		utils.Fatal("unknown file type")
+		utils.Fatal(&InputError{File: file, Msg: "unknown file type"})
+	}
+
+	// 在同一个group中的文件共享同一个位置，
+	// 这样它们之间可以互相解析符号
+	if !ctx.Reader.InGroup {
+		ctx.Reader.Position++
+	}
+}
+
+// -t打印实际加载的每个文件，归档成员要等到被拉进来时才打印
+func TraceFile(ctx *Context, file *File) {
+	if ctx.Args.Trace {
+		fmt.Println(file)
 	}
 }
 
 func CreateObjectFile(ctx *Context, file *File, inLib bool) *ObjectFile {
 	CheckFileCompatibility(ctx, file)
 	obj := NewObjectFile(file, !inLib)
-	obj.Parse(ctx)
+	obj.Position = ctx.Reader.Position
 	return obj
 }
+
+func CreateSharedFile(ctx *Context, file *File) *SharedFile {
+	CheckFileCompatibility(ctx, file)
+	dso := NewSharedFile(file)
+	dso.IsAlive = !ctx.Reader.AsNeeded
+	dso.Position = ctx.Reader.Position
+	return dso
+}
@@ -14,6 +14,10 @@ type InputFile struct {
 	ShStrtab     []byte
 	SymbolStrtab []byte
 	IsAlive      bool
+	IsDso        bool
+	Position     int
+	// 并行解析符号时用来决定哪个文件中的定义胜出，值越小优先级越高
+	Priority     int
 	Symbols      []*Symbol
 	LocalSymbols []Symbol
 }
@@ -23,13 +27,16 @@ func NewInputFile(file *File) InputFile {
 		File: file,
 	}
 	if len(file.Contents) < EhdrSize {
-		utils.Fatal("file too small")
+		utils.Fatal(&InputError{File: file, Msg: "file too small"})
 	}
 	if !CheckMagic(f.File.Contents) {
-		utils.Fatal("not an ELF file")
+		utils.Fatal(&InputError{File: file, Msg: "not an ELF file"})
 	}
 
 	ehdr := utils.Read[Ehdr](file.Contents)
+	if ehdr.ShOff+uint64(ShdrSize) > uint64(len(file.Contents)) {
+		utils.Fatal(&InputError{File: file, Msg: "section header table is out of range"})
+	}
 	contents := file.Contents[ehdr.ShOff:]
 	shdr := utils.Read[Shdr](contents)
 
@@ -37,6 +44,9 @@ func NewInputFile(file *File) InputFile {
 	if numSections == 0 {
 		numSections = shdr.Size
 	}
+	if numSections*uint64(ShdrSize) > uint64(len(contents)) {
+		utils.Fatal(&InputError{File: file, Msg: "section header table is out of range"})
+	}
 
 	f.ElfSections = []Shdr{shdr}
 
@@ -61,7 +71,10 @@ func NewInputFile(file *File) InputFile {
 func (f *InputFile) GetBytesFromShdr(s *Shdr) []byte {
 	end := s.Offset + s.Size
 	if uint64(len(f.File.Contents)) < end {
-		utils.Fatal(fmt.Sprintf("section header is out of range: %d", s.Offset))
+		utils.Fatal(&InputError{
+			File: f.File,
+			Msg:  fmt.Sprintf("section header is out of range: %d", s.Offset),
+		})
 	}
 
 	return f.File.Contents[s.Offset : s.Offset+s.Size]
@@ -89,3 +102,11 @@ func (f *InputFile) FindSection(ty uint32) *Shdr {
 func (f *InputFile) GetEhdr() Ehdr {
 	return utils.Read[Ehdr](f.File.Contents)
 }
+
+func (f *InputFile) ClearSymbols() {
+	for _, sym := range f.Symbols[f.FirstGlobal:] {
+		if sym.File == f {
+			sym.Clear()
+		}
+	}
+}
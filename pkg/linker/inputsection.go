@@ -1,10 +1,16 @@
 package linker
 
 import (
+	"bytes"
+	"compress/zlib"
 	"debug/elf"
+	"fmt"
+	"io"
 	"math"
 	"math/bits"
 	"rvld/pkg/utils"
+
+	"github.com/klauspost/compress/zstd"
 )
 
 type InputSection struct {
@@ -20,6 +26,14 @@ type InputSection struct {
 
 	RelsecIdx uint32
 	Rels      []Rela
+
+	NumDynrel    uint32
+	RelDynOffset uint64
+	Relrs        []uint64
+
+	// 这个段中的函数的FDE在File.Fdes中的范围
+	FdeBegin uint32
+	FdeEnd   uint32
 }
 
 func NewInputSection(ctx *Context, name string, file *ObjectFile, shndx uint32) *InputSection {
@@ -33,10 +47,13 @@ func NewInputSection(ctx *Context, name string, file *ObjectFile, shndx uint32)
 	}
 
 	shdr := s.Shdr()
-	s.Contents = file.File.Contents[shdr.Offset : shdr.Offset+shdr.Size]
-
-	utils.Assert((shdr.Flags & uint64(elf.SHF_COMPRESSED)) == 0)
-	s.ShSize = uint32(shdr.Size)
+	align := shdr.AddrAlign
+	if shdr.Flags&uint64(elf.SHF_COMPRESSED) != 0 {
+		align = s.uncompress()
+	} else {
+		s.Contents = file.File.Contents[shdr.Offset : shdr.Offset+shdr.Size]
+		s.ShSize = uint32(shdr.Size)
+	}
 
 	toP2Align := func(align uint64) uint8 {
 		if align == 0 {
@@ -44,13 +61,54 @@ func NewInputSection(ctx *Context, name string, file *ObjectFile, shndx uint32)
 		}
 		return uint8(bits.TrailingZeros64(align))
 	}
-	s.P2Align = toP2Align(shdr.AddrAlign)
-
-	s.OutputSection =
-		GetOutputSection(ctx, name, uint64(shdr.Type), shdr.Flags)
+	s.P2Align = toP2Align(align)
 	return s
 }
 
+// 压缩的段以Chdr开头，解压后的大小和对齐都记录在Chdr中而不是段头中
+func (i *InputSection) uncompress() uint64 {
+	shdr := i.Shdr()
+	data := i.File.File.Contents[shdr.Offset : shdr.Offset+shdr.Size]
+	fatal := func(msg string) {
+		utils.Fatal(&InputError{File: i.File.File, Msg: i.Name() + ": " + msg})
+	}
+
+	if len(data) < ChdrSize {
+		fatal("corrupted compressed section")
+	}
+	chdr := utils.Read[Chdr](data)
+	data = data[ChdrSize:]
+
+	var contents []byte
+	var err error
+	switch elf.CompressionType(chdr.Type) {
+	case elf.COMPRESS_ZLIB:
+		var r io.ReadCloser
+		if r, err = zlib.NewReader(bytes.NewReader(data)); err == nil {
+			contents, err = io.ReadAll(r)
+		}
+	case elf.COMPRESS_ZSTD:
+		var d *zstd.Decoder
+		if d, err = zstd.NewReader(nil, zstd.WithDecoderConcurrency(1)); err == nil {
+			contents, err = d.DecodeAll(data, nil)
+			d.Close()
+		}
+	default:
+		fatal(fmt.Sprintf("unsupported compression type: 0x%x", chdr.Type))
+	}
+
+	if err != nil {
+		fatal("uncompress failed: " + err.Error())
+	}
+	if uint64(len(contents)) != chdr.Size {
+		fatal("uncompress: invalid size")
+	}
+
+	i.Contents = contents
+	i.ShSize = uint32(chdr.Size)
+	return chdr.AddrAlign
+}
+
 func (i *InputSection) Shdr() *Shdr {
 	utils.Assert(i.Shndx < uint32(len(i.File.ElfSections)))
 	return &i.File.ElfSections[i.Shndx]
@@ -68,8 +126,15 @@ func (i *InputSection) WriteTo(ctx *Context, buf []byte) {
 
 	i.CopyContents(buf)
 
+	// -r时重定位留给之后的链接处理
+	if ctx.Args.Relocatable {
+		return
+	}
+
 	if i.Shdr().Flags&uint64(elf.SHF_ALLOC) != 0 {
 		i.ApplyRelocAlloc(ctx, buf)
+	} else {
+		i.ApplyRelocNonAlloc(ctx, buf)
 	}
 }
 
@@ -88,26 +153,190 @@ func (i *InputSection) GetRels() []Rela {
 	return i.Rels
 }
 
+func (i *InputSection) GetFdes() []FdeRecord {
+	return i.File.Fdes[i.FdeBegin:i.FdeEnd]
+}
+
 func (i *InputSection) GetAddr() uint64 {
 	return i.OutputSection.Shdr.Addr + uint64(i.Offset)
 }
 
-func (i *InputSection) ScanRelocations() {
+type relAction uint8
+
+const (
+	actionNone relAction = iota
+	actionError
+	actionCopyrel
+	actionPlt
+	actionCanonicalPlt
+	actionDynrel
+	actionBaserel
+)
+
+const (
+	outputTypeShared = iota
+	outputTypePie
+	outputTypeExec
+)
+
+func getOutputType(ctx *Context) int {
+	if ctx.Args.Shared {
+		return outputTypeShared
+	}
+	if ctx.Args.Pie {
+		return outputTypePie
+	}
+	return outputTypeExec
+}
+
+// 行对应输出文件的类型，列对应符号的种类，
+// 分别是绝对符号、本地符号、动态库中的数据和动态库中的函数
+type relTable [3][4]relAction
+
+// 链接器定义的符号虽然没有所属的输入段，但它们指向输出文件中的某个位置，不是绝对符号
+func getSymbolKind(ctx *Context, sym *Symbol) int {
+	if !sym.IsImported {
+		if sym.InputSection == nil && sym.SectionFragment == nil &&
+			sym.File != &ctx.InternalObj.InputFile {
+			return 0
+		}
+		return 1
+	}
+
+	if elf.ST_TYPE(sym.ElfSym().Info) == elf.STT_FUNC {
+		return 3
+	}
+	return 2
+}
+
+func (t *relTable) get(ctx *Context, sym *Symbol) relAction {
+	return t[getOutputType(ctx)][getSymbolKind(ctx, sym)]
+}
+
+// 绝对地址重定位，例如R_RISCV_HI20
+var absRelTable = relTable{
+	{actionNone, actionError, actionError, actionError},
+	{actionNone, actionError, actionError, actionError},
+	{actionNone, actionNone, actionCopyrel, actionCanonicalPlt},
+}
+
+// 可写段中的R_RISCV_64
+var dynAbsRelTable = relTable{
+	{actionNone, actionBaserel, actionDynrel, actionDynrel},
+	{actionNone, actionBaserel, actionDynrel, actionDynrel},
+	{actionNone, actionNone, actionDynrel, actionDynrel},
+}
+
+// PC相对地址重定位，例如R_RISCV_PCREL_HI20
+var pcRelTable = relTable{
+	{actionError, actionNone, actionError, actionPlt},
+	{actionError, actionNone, actionCopyrel, actionPlt},
+	{actionNone, actionNone, actionCopyrel, actionCanonicalPlt},
+}
+
+func (i *InputSection) ScanRelocations(ctx *Context) {
 	for _, rel := range i.GetRels() {
 		sym := i.File.Symbols[rel.Sym]
 		if sym.File == nil {
 			continue
 		}
 
-		if rel.Type == uint32(elf.R_RISCV_TLS_GOT_HI20) {
-			sym.Flags |= NeedsGotTp
+		if sym.IsImported {
+			sym.AddFlags(NeedsDynsym)
+		}
+
+		if sym.IsIfunc {
+			if ctx.Iplt == nil || ctx.Dynsym != nil {
+				ctx.Diag.Error(fmt.Errorf("%s: IFUNC symbol %s is only supported "+
+					"in static executables", i.File.File, sym.Name))
+				continue
+			}
+			sym.AddFlags(NeedsIplt)
+		}
+
+		switch elf.R_RISCV(rel.Type) {
+		case elf.R_RISCV_64:
+			if i.Shdr().Flags&uint64(elf.SHF_WRITE) != 0 {
+				i.dispatch(ctx, &dynAbsRelTable, rel, sym)
+			} else {
+				i.dispatch(ctx, &absRelTable, rel, sym)
+			}
+		case elf.R_RISCV_32, elf.R_RISCV_HI20:
+			// RV64上没有32位的动态重定位，PIC中只能用于绝对符号
+			i.dispatch(ctx, &absRelTable, rel, sym)
+		case elf.R_RISCV_PCREL_HI20:
+			i.dispatch(ctx, &pcRelTable, rel, sym)
+		case elf.R_RISCV_CALL, elf.R_RISCV_CALL_PLT:
+			if sym.IsImported {
+				sym.AddFlags(NeedsPlt)
+			}
+		case elf.R_RISCV_GOT_HI20:
+			sym.AddFlags(NeedsGot)
+		case elf.R_RISCV_TLS_GOT_HI20:
+			sym.AddFlags(NeedsGotTp)
+		case elf.R_RISCV_TLS_GD_HI20:
+			sym.AddFlags(NeedsTlsGd)
+		case elf.R_RISCV_TPREL_HI20:
+			if ctx.Args.Shared {
+				i.reportPicError(ctx, rel, sym)
+			}
+		}
+	}
+}
+
+func (i *InputSection) reportPicError(ctx *Context, rel Rela, sym *Symbol) {
+	kind := "a PIE object"
+	if ctx.Args.Shared {
+		kind = "a shared object"
+	}
+
+	ctx.Diag.Error(fmt.Errorf("%s: relocation %v against `%s' can not be used "+
+		"when making %s; recompile with -fPIC",
+		i.File.File, elf.R_RISCV(rel.Type), sym.Name, kind))
+}
+
+func (i *InputSection) dispatch(ctx *Context, table *relTable, rel Rela, sym *Symbol) {
+	switch table.get(ctx, sym) {
+	case actionNone:
+	case actionError:
+		i.reportPicError(ctx, rel, sym)
+	case actionCopyrel:
+		if !ctx.Args.ZCopyreloc {
+			ctx.Diag.Error(fmt.Errorf("%s: relocation %v against `%s' requires a copy relocation "+
+				"but -z nocopyreloc is given; recompile with -fPIC",
+				i.File.File, elf.R_RISCV(rel.Type), sym.Name))
+			return
+		}
+		sym.AddFlags(NeedsCopyrel)
+	case actionPlt:
+		sym.AddFlags(NeedsPlt)
+	case actionCanonicalPlt:
+		// 非PIC代码中获取动态库中函数的地址，这个函数的地址就是它的PLT表项的地址
+		sym.AddFlags(NeedsPlt | NeedsCanonicalPlt)
+	case actionDynrel:
+		i.NumDynrel++
+	case actionBaserel:
+		if i.isRelr(ctx, rel) {
+			i.Relrs = append(i.Relrs, rel.Offset)
+		} else {
+			i.NumDynrel++
 		}
 	}
 }
 
+// 对齐的R_RISCV_RELATIVE重定位可以用更紧凑的.relr.dyn格式表示
+func (i *InputSection) isRelr(ctx *Context, rel Rela) bool {
+	return ctx.Args.PackDynRelocsRelr && i.P2Align >= 3 && rel.Offset%8 == 0
+}
+
 func (i *InputSection) ApplyRelocAlloc(ctx *Context, base []byte) {
 	rels := i.GetRels()
 
+	var relDyn []byte
+	if i.NumDynrel > 0 {
+		relDyn = ctx.Buf[ctx.RelDyn.Shdr.Offset+i.RelDynOffset:]
+	}
+
 	for a := 0; a < len(rels); a++ {
 		rel := rels[a]
 		if rel.Type == uint32(elf.R_RISCV_NONE) ||
@@ -122,28 +351,66 @@ func (i *InputSection) ApplyRelocAlloc(ctx *Context, base []byte) {
 			continue
 		}
 
-		S := sym.GetAddr()
+		S := sym.GetAddr(ctx)
 		A := uint64(rel.Addend)
 		P := i.GetAddr() + rel.Offset
 
 		switch elf.R_RISCV(rel.Type) {
 		case elf.R_RISCV_32:
+			i.checkRange(ctx, rel, sym, int64(S+A), math.MinInt32, math.MaxUint32+1)
 			utils.Write[uint32](loc, uint32(S+A))
 		case elf.R_RISCV_64:
-			utils.Write[uint64](loc, S+A)
+			action := actionNone
+			if i.Shdr().Flags&uint64(elf.SHF_WRITE) != 0 {
+				action = dynAbsRelTable.get(ctx, sym)
+			}
+
+			switch {
+			case action == actionDynrel:
+				utils.Write[Rela](relDyn, Rela{
+					Offset: P,
+					Type:   uint32(elf.R_RISCV_64),
+					Sym:    uint32(sym.DynsymIdx),
+					Addend: int64(A),
+				})
+				relDyn = relDyn[RelaSize:]
+				utils.Write[uint64](loc, 0)
+			case action == actionBaserel && !i.isRelr(ctx, rel):
+				utils.Write[Rela](relDyn, Rela{
+					Offset: P,
+					Type:   uint32(elf.R_RISCV_RELATIVE),
+					Addend: int64(S + A),
+				})
+				relDyn = relDyn[RelaSize:]
+				utils.Write[uint64](loc, S+A)
+			default:
+				utils.Write[uint64](loc, S+A)
+			}
 		case elf.R_RISCV_BRANCH:
+			i.checkRange(ctx, rel, sym, int64(S+A-P), -(1 << 12), 1<<12)
 			writeBtype(loc, uint32(S+A-P))
 		case elf.R_RISCV_JAL:
+			i.checkRange(ctx, rel, sym, int64(S+A-P), -(1 << 20), 1<<20)
 			writeJtype(loc, uint32(S+A-P))
 		case elf.R_RISCV_CALL, elf.R_RISCV_CALL_PLT:
+			i.checkHi20Range(ctx, rel, sym, int64(S+A-P))
 			val := uint32(S + A - P)
 			writeUtype(loc, val)
 			writeItype(loc[4:], val)
+		case elf.R_RISCV_GOT_HI20:
+			i.checkHi20Range(ctx, rel, sym, int64(sym.GetGotAddr(ctx)+A-P))
+			utils.Write[uint32](loc, uint32(sym.GetGotAddr(ctx)+A-P))
 		case elf.R_RISCV_TLS_GOT_HI20:
+			i.checkHi20Range(ctx, rel, sym, int64(sym.GetGotTpAddr(ctx)+A-P))
 			utils.Write[uint32](loc, uint32(sym.GetGotTpAddr(ctx)+A-P))
+		case elf.R_RISCV_TLS_GD_HI20:
+			i.checkHi20Range(ctx, rel, sym, int64(sym.GetTlsGdAddr(ctx)+A-P))
+			utils.Write[uint32](loc, uint32(sym.GetTlsGdAddr(ctx)+A-P))
 		case elf.R_RISCV_PCREL_HI20:
+			i.checkHi20Range(ctx, rel, sym, int64(S+A-P))
 			utils.Write[uint32](loc, uint32(S+A-P))
 		case elf.R_RISCV_HI20:
+			i.checkHi20Range(ctx, rel, sym, int64(S+A))
 			writeUtype(loc, uint32(S+A))
 		case elf.R_RISCV_LO12_I, elf.R_RISCV_LO12_S:
 			val := S + A
@@ -188,7 +455,8 @@ func (i *InputSection) ApplyRelocAlloc(ctx *Context, base []byte) {
 
 	for a := 0; a < len(rels); a++ {
 		switch elf.R_RISCV(rels[a].Type) {
-		case elf.R_RISCV_PCREL_HI20, elf.R_RISCV_TLS_GOT_HI20:
+		case elf.R_RISCV_GOT_HI20, elf.R_RISCV_PCREL_HI20, elf.R_RISCV_TLS_GOT_HI20,
+			elf.R_RISCV_TLS_GD_HI20:
 			loc := base[rels[a].Offset:]
 			val := utils.Read[uint32](loc)
 			utils.Write[uint32](loc, utils.Read[uint32](i.Contents[rels[a].Offset:]))
@@ -197,6 +465,176 @@ func (i *InputSection) ApplyRelocAlloc(ctx *Context, base []byte) {
 	}
 }
 
+// 调试信息等不加载到内存中的段里只有简单的绝对地址和标签之间的差值
+func (i *InputSection) ApplyRelocNonAlloc(ctx *Context, base []byte) {
+	for _, rel := range i.GetRels() {
+		if rel.Type == uint32(elf.R_RISCV_NONE) ||
+			rel.Type == uint32(elf.R_RISCV_RELAX) {
+			continue
+		}
+
+		sym := i.File.Symbols[rel.Sym]
+		loc := base[rel.Offset:]
+		if sym.File == nil {
+			continue
+		}
+
+		var S, A uint64
+		if frag, offset := i.getFragment(rel); frag != nil {
+			S = frag.GetAddr()
+			A = offset
+		} else {
+			S = sym.GetAddr(ctx)
+			A = uint64(rel.Addend)
+		}
+
+		switch rel.Type {
+		case uint32(elf.R_RISCV_32):
+			if val, ok := i.getTombstone(sym); ok {
+				utils.Write[uint32](loc, uint32(val))
+			} else {
+				utils.Write[uint32](loc, uint32(S+A))
+			}
+		case uint32(elf.R_RISCV_64):
+			if val, ok := i.getTombstone(sym); ok {
+				utils.Write[uint64](loc, val)
+			} else {
+				utils.Write[uint64](loc, S+A)
+			}
+		case uint32(elf.R_RISCV_TLS_DTPREL32):
+			if val, ok := i.getTombstone(sym); ok {
+				utils.Write[uint32](loc, uint32(val))
+			} else {
+				utils.Write[uint32](loc, uint32(S+A-ctx.TpAddr-TlsDtvOffset))
+			}
+		case uint32(elf.R_RISCV_TLS_DTPREL64):
+			if val, ok := i.getTombstone(sym); ok {
+				utils.Write[uint64](loc, val)
+			} else {
+				utils.Write[uint64](loc, S+A-ctx.TpAddr-TlsDtvOffset)
+			}
+		default:
+			known, err := applyLabelDiff(loc, rel.Type, S+A)
+			if !known {
+				utils.Fatal(&InputError{
+					File: i.File.File,
+					Msg: fmt.Sprintf("%s: invalid relocation %v for non-allocated sections",
+						i.Name(), elf.R_RISCV(rel.Type)),
+				})
+			}
+			if err != nil {
+				ctx.Diag.Error(&InputError{
+					File: i.File.File,
+					Msg:  fmt.Sprintf("%s+0x%x: %v", i.Name(), rel.Offset, err),
+				})
+			}
+		}
+	}
+}
+
+// 两个标签之间的差值由一对ADD/SUB或SET/SUB重定位算出，调试信息和.eh_frame中都会用到。
+// 不认识的重定位类型返回false，值写不下时返回错误
+func applyLabelDiff(loc []byte, typ uint32, val uint64) (bool, error) {
+	switch typ {
+	case uint32(elf.R_RISCV_ADD8):
+		loc[0] += uint8(val)
+	case uint32(elf.R_RISCV_ADD16):
+		utils.Write[uint16](loc, utils.Read[uint16](loc)+uint16(val))
+	case uint32(elf.R_RISCV_ADD32):
+		utils.Write[uint32](loc, utils.Read[uint32](loc)+uint32(val))
+	case uint32(elf.R_RISCV_ADD64):
+		utils.Write[uint64](loc, utils.Read[uint64](loc)+val)
+	case uint32(elf.R_RISCV_SUB8):
+		loc[0] -= uint8(val)
+	case uint32(elf.R_RISCV_SUB16):
+		utils.Write[uint16](loc, utils.Read[uint16](loc)-uint16(val))
+	case uint32(elf.R_RISCV_SUB32):
+		utils.Write[uint32](loc, utils.Read[uint32](loc)-uint32(val))
+	case uint32(elf.R_RISCV_SUB64):
+		utils.Write[uint64](loc, utils.Read[uint64](loc)-val)
+	case uint32(elf.R_RISCV_SUB6):
+		loc[0] = loc[0]&0b1100_0000 | (loc[0]-uint8(val))&0b0011_1111
+	case uint32(elf.R_RISCV_SET6):
+		loc[0] = loc[0]&0b1100_0000 | uint8(val)&0b0011_1111
+	case uint32(elf.R_RISCV_SET8):
+		loc[0] = uint8(val)
+	case uint32(elf.R_RISCV_SET16):
+		utils.Write[uint16](loc, uint16(val))
+	case uint32(elf.R_RISCV_SET32):
+		utils.Write[uint32](loc, uint32(val))
+	case R_RISCV_SET_ULEB128, R_RISCV_SUB_ULEB128:
+		name := "R_RISCV_SET_ULEB128"
+		if typ == R_RISCV_SUB_ULEB128 {
+			name = "R_RISCV_SUB_ULEB128"
+			val = utils.ReadUleb(loc) - val
+		}
+		if !utils.OverwriteUleb(loc, val) {
+			return true, fmt.Errorf("relocation %s out of range: %d does not fit "+
+				"in the existing ULEB128 field", name, int64(val))
+		}
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// 可合并的段被拆分成了片段，通过段符号引用其中的数据时，要用加数找到对应的片段，
+// 例如.debug_info中对.debug_str的引用
+func (i *InputSection) getFragment(rel Rela) (*SectionFragment, uint64) {
+	esym := &i.File.ElfSyms[rel.Sym]
+	if esym.Type() != uint8(elf.STT_SECTION) {
+		return nil, 0
+	}
+
+	m := i.File.MergeableSections[i.File.GetShndx(esym, int(rel.Sym))]
+	if m == nil {
+		return nil, 0
+	}
+
+	frag, offset := m.GetFragment(uint32(rel.Addend))
+	if frag == nil {
+		utils.Fatal(&InputError{
+			File: i.File.File,
+			Msg:  fmt.Sprintf("%s: bad relocation at offset 0x%x", i.Name(), rel.Offset),
+		})
+	}
+	return frag, uint64(offset)
+}
+
+// 被丢弃的段没有地址，指向它的引用和lld一样写入-1，因为0在PIE和动态库中是合法的地址。
+// 但.debug_loc和.debug_ranges中-1表示基地址选择项，所以用-2
+func (i *InputSection) getTombstone(sym *Symbol) (uint64, bool) {
+	if sym.InputSection == nil || sym.InputSection.IsAlive {
+		return 0, false
+	}
+
+	if name := i.Name(); name == ".debug_loc" || name == ".debug_ranges" {
+		return math.MaxUint64 - 1, true
+	}
+	return math.MaxUint64, true
+}
+
+// 检查重定位的值是否在[lo, hi)范围内，超出时报错但继续处理其他重定位
+func (i *InputSection) checkRange(ctx *Context, rel Rela, sym *Symbol, val, lo, hi int64) {
+	if val < lo || val >= hi {
+		ctx.Diag.Error(&RelocationOverflowError{
+			File:    i.File.File,
+			Section: i.Name(),
+			Offset:  rel.Offset,
+			Type:    elf.R_RISCV(rel.Type),
+			Symbol:  sym.Name,
+			Val:     val,
+			Min:     lo,
+			Max:     hi,
+		})
+	}
+}
+
+// 高20位加上低12位的符号扩展之后能表示的范围
+func (i *InputSection) checkHi20Range(ctx *Context, rel Rela, sym *Symbol, val int64) {
+	i.checkRange(ctx, rel, sym, val, math.MinInt32-0x800, math.MaxInt32-0x800+1)
+}
+
 func itype(val uint32) uint32 {
 	return val << 20
 }
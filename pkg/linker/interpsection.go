@@ -0,0 +1,25 @@
+package linker
+
+import "debug/elf"
+
+type InterpSection struct {
+	Chunk
+}
+
+func NewInterpSection() *InterpSection {
+	i := &InterpSection{Chunk: NewChunk()}
+	i.Name = ".interp"
+	i.Shdr.Type = uint32(elf.SHT_PROGBITS)
+	i.Shdr.Flags = uint64(elf.SHF_ALLOC)
+	return i
+}
+
+func (i *InterpSection) UpdateShdr(ctx *Context) {
+	i.Shdr.Size = uint64(len(ctx.Args.DynamicLinker)) + 1
+}
+
+func (i *InterpSection) CopyBuf(ctx *Context) {
+	base := ctx.Buf[i.Shdr.Offset:]
+	copy(base, ctx.Args.DynamicLinker)
+	base[len(ctx.Args.DynamicLinker)] = 0
+}
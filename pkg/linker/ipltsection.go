@@ -0,0 +1,73 @@
+package linker
+
+import (
+	"debug/elf"
+	"rvld/pkg/utils"
+)
+
+// 静态链接的可执行文件中，对IFUNC的调用都经过.iplt，
+// 它对应的GOT表项在程序启动时由libc根据.rela.iplt填入解析函数的返回值
+type IpltSection struct {
+	Chunk
+	Symbols []*Symbol
+}
+
+func NewIpltSection() *IpltSection {
+	i := &IpltSection{Chunk: NewChunk()}
+	i.Name = ".iplt"
+	i.Shdr.Type = uint32(elf.SHT_PROGBITS)
+	i.Shdr.Flags = uint64(elf.SHF_ALLOC | elf.SHF_EXECINSTR)
+	i.Shdr.AddrAlign = 16
+	return i
+}
+
+func (i *IpltSection) AddSymbol(ctx *Context, sym *Symbol) {
+	if sym.IpltIdx != -1 {
+		return
+	}
+
+	sym.IpltIdx = int32(len(i.Symbols))
+	i.Symbols = append(i.Symbols, sym)
+	i.Shdr.Size += PltEntrySize
+	ctx.Got.AddIpltSymbol(sym)
+}
+
+func (i *IpltSection) CopyBuf(ctx *Context) {
+	base := ctx.Buf[i.Shdr.Offset:]
+	for _, sym := range i.Symbols {
+		ent := base[uint64(sym.IpltIdx)*PltEntrySize:]
+		utils.Write(ent, pltEntry)
+		disp := uint32(sym.GetIpltGotAddr(ctx) - sym.GetIpltAddr(ctx))
+		writeUtype(ent, disp)
+		writeItype(ent[4:], disp)
+	}
+}
+
+type RelIpltSection struct {
+	Chunk
+}
+
+func NewRelIpltSection() *RelIpltSection {
+	r := &RelIpltSection{Chunk: NewChunk()}
+	r.Name = ".rela.iplt"
+	r.Shdr.Type = uint32(elf.SHT_RELA)
+	r.Shdr.Flags = uint64(elf.SHF_ALLOC)
+	r.Shdr.EntSize = uint64(RelaSize)
+	r.Shdr.AddrAlign = 8
+	return r
+}
+
+func (r *RelIpltSection) UpdateShdr(ctx *Context) {
+	r.Shdr.Size = uint64(len(ctx.Iplt.Symbols)) * uint64(RelaSize)
+}
+
+func (r *RelIpltSection) CopyBuf(ctx *Context) {
+	base := ctx.Buf[r.Shdr.Offset:]
+	for _, sym := range ctx.Iplt.Symbols {
+		utils.Write[Rela](base[int(sym.IpltIdx)*RelaSize:], Rela{
+			Offset: sym.GetIpltGotAddr(ctx),
+			Type:   R_RISCV_IRELATIVE,
+			Addend: int64(sym.GetDefinedAddr(ctx)),
+		})
+	}
+}
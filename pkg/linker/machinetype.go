@@ -15,7 +15,7 @@ const (
 func GetMachineTypeFromContents(contents []byte) MachineType {
 	fileType := GetFileType(contents)
 	switch fileType {
-	case FileTypeObject:
+	case FileTypeObject, FileTypeDso:
 		machine := utils.Read[uint16](contents[18:])
 		if machine == uint16(elf.EM_RISCV) {
 			class := elf.Class(contents[4])
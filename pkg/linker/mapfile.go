@@ -0,0 +1,126 @@
+package linker
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"rvld/pkg/utils"
+	"sort"
+)
+
+// 按照GNU ld的格式输出链接映射，-Map=FILE写入文件，-M写到标准输出
+func PrintMap(ctx *Context) {
+	if ctx.Args.MapFile != "" {
+		file, err := os.Create(ctx.Args.MapFile)
+		utils.MustNo(err)
+		w := bufio.NewWriter(file)
+		writeMap(ctx, w)
+		utils.MustNo(w.Flush())
+		utils.MustNo(file.Close())
+	}
+
+	if ctx.Args.PrintMap {
+		w := bufio.NewWriter(os.Stdout)
+		writeMap(ctx, w)
+		utils.MustNo(w.Flush())
+	}
+}
+
+func writeMap(ctx *Context, w io.Writer) {
+	fmt.Fprintf(w, "Archive member included to satisfy reference by file (symbol)\n\n")
+	for _, file := range ctx.Objs {
+		if file.IsAlive && file.ExtractedBy != nil {
+			fmt.Fprintf(w, "%s\n%30s%s (%s)\n", file.File, "",
+				file.ExtractedBy.File, file.ExtractedSym.Name)
+		}
+	}
+
+	fmt.Fprintf(w, "\nMemory map\n\n")
+	syms := collectSectionSymbols(ctx)
+	for _, chunk := range ctx.Chunks {
+		shdr := chunk.GetShdr()
+		fmt.Fprintf(w, "%-16s 0x%016x %10s (align %d)\n", getChunkMapName(chunk), shdr.Addr,
+			fmt.Sprintf("0x%x", shdr.Size), shdr.AddrAlign)
+
+		switch c := chunk.(type) {
+		case *OutputSection:
+			for _, member := range c.Members {
+				fmt.Fprintf(w, " %-15s 0x%016x %10s %s\n", member.Name(), member.GetAddr(),
+					fmt.Sprintf("0x%x", member.ShSize), member.File.File)
+				for _, sym := range syms[member] {
+					fmt.Fprintf(w, "%16s 0x%016x %10s %s\n", "", sym.GetDefinedAddr(ctx), "",
+						sym.Name)
+				}
+			}
+		case *MergedSection:
+			writeMergedSectionMap(ctx, w, c)
+		}
+	}
+}
+
+// ELF头、程序头和段头没有名字
+func getChunkMapName(chunk Chunker) string {
+	switch chunk.(type) {
+	case *OutputEhdr:
+		return "<ehdr>"
+	case *OutputPhdr:
+		return "<phdr>"
+	case *OutputShdr:
+		return "<shdr>"
+	}
+	return chunk.GetName()
+}
+
+// 每个InputSection中定义的全局符号，按地址排序
+func collectSectionSymbols(ctx *Context) map[*InputSection][]*Symbol {
+	syms := make(map[*InputSection][]*Symbol)
+	for _, file := range ctx.Objs {
+		if !file.IsAlive {
+			continue
+		}
+
+		for _, sym := range file.Symbols[file.FirstGlobal:] {
+			if sym.File == &file.InputFile && sym.InputSection != nil &&
+				sym.InputSection.IsAlive {
+				syms[sym.InputSection] = append(syms[sym.InputSection], sym)
+			}
+		}
+	}
+
+	for _, list := range syms {
+		sort.SliceStable(list, func(i, j int) bool {
+			return list[i].Value < list[j].Value
+		})
+	}
+	return syms
+}
+
+// 合并段只输出每个输入文件贡献了多少数据，以及去重之后剩下多少片段
+func writeMergedSectionMap(ctx *Context, w io.Writer, m *MergedSection) {
+	numFrags := 0
+	m.Map.Range(func(key string, frag *SectionFragment) {
+		numFrags++
+	})
+
+	inputSize := 0
+	for _, file := range ctx.Objs {
+		if !file.IsAlive {
+			continue
+		}
+
+		for i, sec := range file.MergeableSections {
+			if sec == nil || sec.Parent != m {
+				continue
+			}
+
+			size := len(file.Sections[i].Contents)
+			inputSize += size
+			fmt.Fprintf(w, " %-15s %18s %10s %s\n", file.Sections[i].Name(), "",
+				fmt.Sprintf("0x%x", size), file.File)
+		}
+	}
+
+	fmt.Fprintf(w, "%16s %d fragments, 0x%x bytes before merging\n", "",
+		numFrags, inputSize)
+}
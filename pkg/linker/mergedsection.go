@@ -7,13 +7,13 @@ import (
 
 type MergedSection struct {
 	Chunk
-	Map map[string]*SectionFragment
+	Map *utils.ShardedMap[*SectionFragment]
 }
 
 func NewMergedSection(name string, flags uint64, typ uint32) *MergedSection {
 	m := &MergedSection{
 		Chunk: NewChunk(),
-		Map:   make(map[string]*SectionFragment),
+		Map:   utils.NewShardedMap[*SectionFragment](),
 	}
 
 	m.Name = name
@@ -28,15 +28,15 @@ func (m *MergedSection) AssignOffsets() {
 		Val *SectionFragment
 	}
 
-	for key := range m.Map {
+	m.Map.Range(func(key string, frag *SectionFragment) {
 		fragments = append(fragments, struct {
 			Key string
 			Val *SectionFragment
 		}{
 			Key: key,
-			Val: m.Map[key],
+			Val: frag,
 		})
-	}
+	})
 
 	sort.SliceStable(fragments, func(i, j int) bool {
 		x := fragments[i]
@@ -66,10 +66,11 @@ func (m *MergedSection) AssignOffsets() {
 }
 
 func (m *MergedSection) CopyBuf(ctx *Context) {
-	buf := ctx.Buf[m.Shdr.Offset:]
-	for key := range m.Map {
-		if frag, ok := m.Map[key]; ok {
-			copy(buf[frag.Offset:], key)
-		}
-	}
+	m.WriteTo(ctx, ctx.Buf[m.Shdr.Offset:])
+}
+
+func (m *MergedSection) WriteTo(ctx *Context, buf []byte) {
+	m.Map.Range(func(key string, frag *SectionFragment) {
+		copy(buf[frag.Offset:], key)
+	})
 }
@@ -3,8 +3,12 @@ package linker
 import (
 	"bytes"
 	"debug/elf"
+	"fmt"
 	"math"
 	"rvld/pkg/utils"
+	"slices"
+	"sort"
+	"strings"
 )
 
 type ObjectFile struct {
@@ -13,6 +17,20 @@ type ObjectFile struct {
 	SymtabShndxSec    []uint32
 	Sections          []*InputSection
 	MergeableSections []*MergeableSection
+
+	// 从.eh_frame中拆出的记录，FDE按所属的段排序
+	Cies []CieRecord
+	Fdes []FdeRecord
+
+	// .symver定义的符号版本，foo@@VER记为"@VER"，foo@VER记为"VER"
+	Symvers []string
+
+	// 归档成员是因为哪个文件中的哪个符号引用而被拉进来的
+	ExtractedBy  *ObjectFile
+	ExtractedSym *Symbol
+
+	// -r时每个符号在输出的.symtab中的下标，0表示没有输出
+	OutputSymIndices []uint32
 }
 
 func NewObjectFile(file *File, isAlive bool) *ObjectFile {
@@ -33,7 +51,9 @@ func (o *ObjectFile) Parse(ctx *Context) {
 	o.InitializeSections(ctx)
 	o.InitializeSymbols(ctx)
 	o.InitializeMergeableSections(ctx)
-	o.SkipEhFrameSections()
+	if !ctx.Args.Relocatable {
+		o.ParseEhFrame()
+	}
 }
 
 func (o *ObjectFile) InitializeSections(ctx *Context) {
@@ -53,7 +73,7 @@ func (o *ObjectFile) InitializeSections(ctx *Context) {
 
 	for i := 0; i < len(o.ElfSections); i++ {
 		shdr := &o.InputFile.ElfSections[i]
-		if shdr.Type != uint32(elf.SHT_REL) {
+		if shdr.Type != uint32(elf.SHT_RELA) {
 			continue
 		}
 
@@ -77,17 +97,18 @@ func (o *ObjectFile) InitializeSymbols(ctx *Context) {
 
 	o.LocalSymbols = make([]Symbol, o.FirstGlobal)
 	for i := 0; i < len(o.LocalSymbols); i++ {
-		o.LocalSymbols[i] = *NewSymbol("")
+		o.LocalSymbols[i].Init("")
 	}
-	o.LocalSymbols[0].File = o
+	o.LocalSymbols[0].File = &o.InputFile
 
 	for i := 1; i < len(o.LocalSymbols); i++ {
 		elfSym := &o.ElfSyms[i]
 		sym := &o.LocalSymbols[i]
 		sym.Name = ElfGetName(o.SymbolStrtab, elfSym.Name)
-		sym.File = o
+		sym.File = &o.InputFile
 		sym.Value = elfSym.Val
 		sym.SymIdx = i
+		sym.IsIfunc = elfSym.Type() == STT_GNU_IFUNC
 		if !elfSym.IsAbs() {
 			sym.SetInputSection(o.Sections[o.GetShndx(elfSym, i)])
 		}
@@ -98,10 +119,26 @@ func (o *ObjectFile) InitializeSymbols(ctx *Context) {
 		o.Symbols[i] = &o.LocalSymbols[i]
 	}
 
+	o.Symvers = make([]string, len(o.ElfSyms))
 	for i := len(o.LocalSymbols); i < len(o.ElfSyms); i++ {
 		elfSym := &o.ElfSyms[i]
 		name := ElfGetName(o.SymbolStrtab, elfSym.Name)
-		o.Symbols[i] = GetSymbolByName(ctx, name)
+		key := name
+
+		if idx := strings.IndexByte(name, '@'); idx != -1 {
+			ver := name[idx+1:]
+			name = name[:idx]
+
+			// foo@@VER是foo的默认版本，通过foo就可以引用到它
+			if strings.HasPrefix(ver, "@") {
+				key = name
+			}
+			if !elfSym.IsUndef() && ver != "" && ver != "@" {
+				o.Symvers[i] = ver
+			}
+		}
+
+		o.Symbols[i] = GetVersionedSymbol(ctx, key, name)
 	}
 }
 
@@ -131,9 +168,89 @@ func (o *ObjectFile) ResolveSymbols() {
 			}
 		}
 
-		if sym.File == nil {
-			sym.File = o
+		sym.mu.Lock()
+		if o.overrides(sym, elfSym) {
+			sym.File = &o.InputFile
 			sym.SetInputSection(inputSection)
+			sym.Value = elfSym.Val
+			sym.SymIdx = i
+			sym.IsIfunc = elfSym.Type() == STT_GNU_IFUNC
+		}
+		sym.mu.Unlock()
+	}
+}
+
+// 强定义优先于弱定义，它们都优先于动态库中的定义，
+// 等级相同时命令行中靠前的文件优先
+func (o *ObjectFile) overrides(sym *Symbol, elfSym *Sym) bool {
+	if sym.File == nil {
+		return true
+	}
+
+	rank := func(file *InputFile, esym *Sym) int {
+		if file.IsDso {
+			return 3
+		}
+		if esym.IsWeak() {
+			return 2
+		}
+		return 1
+	}
+
+	r1 := rank(&o.InputFile, elfSym)
+	r2 := rank(sym.File, sym.ElfSym())
+	return r1 < r2 || (r1 == r2 && sym.File.Priority > o.Priority)
+}
+
+// 链接器定义的符号只在没有输入文件定义它们时才生效，不参与强弱定义的比较
+func (o *ObjectFile) ProvideSymbols() {
+	for i := o.FirstGlobal; i < len(o.ElfSyms); i++ {
+		sym := o.Symbols[i]
+		if sym.File == nil || sym.File.IsDso {
+			sym.File = &o.InputFile
+			sym.SetInputSection(nil)
+			sym.Value = o.ElfSyms[i].Val
+			sym.SymIdx = i
+		}
+	}
+}
+
+func (o *ObjectFile) MergeVisibility() {
+	for i := o.FirstGlobal; i < len(o.ElfSyms); i++ {
+		o.Symbols[i].MergeVisibility(elf.ST_VISIBILITY(o.ElfSyms[i].Other))
+	}
+}
+
+// 隐藏的符号只能在本模块中定义，不能由动态库提供
+func (o *ObjectFile) CheckHiddenSymbols(ctx *Context) {
+	for i := o.FirstGlobal; i < len(o.ElfSyms); i++ {
+		sym := o.Symbols[i]
+		elfSym := &o.ElfSyms[i]
+		if !elfSym.IsUndef() || !sym.IsHidden() || (sym.File != nil && !sym.File.IsDso) {
+			continue
+		}
+
+		// 弱引用在找不到定义时被解析为0
+		if elfSym.IsWeak() {
+			if sym.File != nil {
+				sym.Clear()
+			}
+			continue
+		}
+
+		ctx.Diag.Error(fmt.Errorf("%s: undefined hidden symbol: %s", o.File, sym.Name))
+	}
+}
+
+// 动态库允许存在未定义的符号，它们会在运行时由动态链接器解析
+func (o *ObjectFile) ClaimUnresolvedSymbols() {
+	for i := o.FirstGlobal; i < len(o.ElfSyms); i++ {
+		sym := o.Symbols[i]
+		if o.ElfSyms[i].IsUndef() && sym.File == nil {
+			sym.File = &o.InputFile
+			sym.SetInputSection(nil)
+			sym.Value = 0
+			sym.SymIdx = i
 		}
 	}
 }
@@ -142,28 +259,118 @@ func (o *ObjectFile) GetSection(elfSym *Sym, idx int) *InputSection {
 	return o.Sections[o.GetShndx(elfSym, idx)]
 }
 
-func (o *ObjectFile) MarkLiveObjects(feeder func(*ObjectFile)) {
+// 符号所在的输入段的名字，用于诊断信息
+func (o *ObjectFile) sectionName(elfSym *Sym, idx int) string {
+	return ElfGetName(o.ShStrtab, o.ElfSections[o.GetShndx(elfSym, idx)].Name)
+}
+
+// 归档成员在被标记为存活之前不参与符号解析，只记录它能提供哪些符号
+func (o *ObjectFile) ResolveLazySymbols() {
+	for i := o.FirstGlobal; i < len(o.ElfSyms); i++ {
+		sym := o.Symbols[i]
+		elfSym := &o.ElfSyms[i]
+
+		if elfSym.IsUndef() || elfSym.IsCommon() ||
+			(!elfSym.IsAbs() && o.GetSection(elfSym, i) == nil) {
+			continue
+		}
+
+		sym.LazyFiles = append(sym.LazyFiles, o)
+	}
+}
+
+func (o *ObjectFile) MarkLiveObjects(ctx *Context, feeder func(*ObjectFile)) {
 	utils.Assert(o.IsAlive)
 
 	for i := o.FirstGlobal; i < len(o.ElfSyms); i++ {
 		sym := o.Symbols[i]
 		elfSym := &o.ElfSyms[i]
 
-		if sym.File == nil {
+		if !elfSym.IsUndef() {
 			continue
 		}
 
-		if elfSym.IsUndef() && !sym.File.IsAlive {
-			sym.File.IsAlive = true
-			feeder(sym.File)
+		var file *ObjectFile
+		if sym.File != nil {
+			if !sym.File.IsDso {
+				continue
+			}
+
+			// 和GNU ld一样，命令行中位于动态库之前的归档成员优先于动态库中的定义
+			if !elfSym.IsWeak() {
+				file = o.findLazyFileBefore(sym, sym.File.Position)
+			}
+			if file == nil {
+				// --as-needed的动态库只有被引用到时才会被记录到DT_NEEDED中
+				sym.File.IsAlive = true
+				continue
+			}
+		} else {
+			// 和GNU ld一样，弱引用不会把归档成员拉进来
+			if elfSym.IsWeak() {
+				continue
+			}
+
+			if file = o.findLazyFile(ctx, sym); file == nil {
+				continue
+			}
+		}
+
+		file.IsAlive = true
+		TraceFile(ctx, file.File)
+		file.ExtractedBy = o
+		file.ExtractedSym = sym
+		file.ResolveSymbols()
+		feeder(file)
+	}
+}
+
+// 按照GNU ld的语义，归档文件只能解析出现在它之前(或与它处于同一个group)的文件中的引用
+func (o *ObjectFile) findLazyFile(ctx *Context, sym *Symbol) *ObjectFile {
+	var file *ObjectFile
+	for _, lazy := range sym.LazyFiles {
+		if lazy.Position >= o.Position {
+			file = lazy
+			break
 		}
 	}
+
+	// lld会选择命令行中第一个定义了该符号的归档成员
+	if ctx.Args.WarnBackrefs && len(sym.LazyFiles) > 0 && sym.LazyFiles[0] != file {
+		ctx.Diag.Warn(fmt.Sprintf("backward reference detected: %s in %s refers to %s",
+			sym.Name, o.File, sym.LazyFiles[0].File))
+	}
+
+	return file
 }
 
-func (o *ObjectFile) ClearSymbols() {
-	for _, sym := range o.Symbols[o.FirstGlobal:] {
-		if sym.File == o {
-			sym.Clear()
+// 位于o和position之间的、能提供sym的归档成员
+func (o *ObjectFile) findLazyFileBefore(sym *Symbol, position int) *ObjectFile {
+	for _, lazy := range sym.LazyFiles {
+		if lazy.Position >= o.Position && lazy.Position < position {
+			return lazy
+		}
+	}
+	return nil
+}
+
+// 输出段按第一次出现的顺序编号，所以要在并行解析完所有文件之后按文件顺序串行地分配
+func (o *ObjectFile) AssignOutputSections(ctx *Context) {
+	for i, section := range o.Sections {
+		if section == nil {
+			continue
+		}
+
+		if ctx.Args.Relocatable {
+			section.OutputSection = GetRelocatableOutputSection(ctx, section)
+			continue
+		}
+
+		shdr := section.Shdr()
+		section.OutputSection =
+			GetOutputSection(ctx, section.Name(), uint64(shdr.Type), shdr.Flags)
+		if m := o.MergeableSections[i]; m != nil {
+			m.Parent = GetMergedSectionInstance(ctx, section.Name(), shdr.Type, shdr.Flags)
 		}
 	}
 }
@@ -172,7 +379,8 @@ func (o *ObjectFile) InitializeMergeableSections(ctx *Context) {
 	o.MergeableSections = make([]*MergeableSection, len(o.Sections))
 	for i := 0; i < len(o.Sections); i++ {
 		section := o.Sections[i]
-		if section != nil && section.IsAlive &&
+		// -r时可合并的段原样输出，由之后的链接再去重
+		if section != nil && section.IsAlive && !ctx.Args.Relocatable &&
 			section.Shdr().Flags&uint64(elf.SHF_MERGE) != 0 {
 			o.MergeableSections[i] = splitSection(ctx, section)
 			section.IsAlive = false
@@ -199,7 +407,6 @@ func splitSection(ctx *Context, section *InputSection) *MergeableSection {
 	m := &MergeableSection{}
 	shdr := section.Shdr()
 
-	m.Parent = GetMergedSectionInstance(ctx, section.Name(), shdr.Type, shdr.Flags)
 	m.P2Align = section.P2Align
 	data := section.Contents
 	offset := uint64(0)
@@ -207,7 +414,10 @@ func splitSection(ctx *Context, section *InputSection) *MergeableSection {
 		for len(data) > 0 {
 			end := findNull(data, int(shdr.EntSize))
 			if end == -1 {
-				utils.Fatal("string is not null terminated")
+				utils.Fatal(&InputError{
+					File: section.File.File,
+					Msg:  section.Name() + ": string is not null terminated",
+				})
 			}
 
 			size := uint64(end) + shdr.EntSize
@@ -219,7 +429,10 @@ func splitSection(ctx *Context, section *InputSection) *MergeableSection {
 		}
 	} else {
 		if uint64(len(data))%shdr.EntSize != 0 {
-			utils.Fatal("section size is not multiple of entsize")
+			utils.Fatal(&InputError{
+				File: section.File.File,
+				Msg:  section.Name() + ": section size is not multiple of entsize",
+			})
 		}
 
 		for len(data) > 0 {
@@ -251,7 +464,8 @@ func (o *ObjectFile) RegisterSectionPieces() {
 		sym := o.Symbols[i]
 		elfSym := &o.ElfSyms[i]
 
-		if elfSym.IsAbs() || elfSym.IsUndef() || elfSym.IsCommon() {
+		if elfSym.IsAbs() || elfSym.IsUndef() || elfSym.IsCommon() ||
+			sym.File != &o.InputFile {
 			continue
 		}
 
@@ -261,26 +475,128 @@ func (o *ObjectFile) RegisterSectionPieces() {
 		}
 		frag, fragOffset := m.GetFragment(uint32(elfSym.Val))
 		if frag == nil {
-			utils.Fatal("bad symbol value")
+			utils.Fatal(&InputError{File: o.File, Msg: "bad symbol value"})
 		}
 		sym.SetSectionFragment(frag)
 		sym.Value = uint64(fragOffset)
 	}
 }
 
-func (o *ObjectFile) SkipEhFrameSections() {
+// -r时.eh_frame原样输出，否则拆成记录，由EhFrameSection重新生成
+func (o *ObjectFile) ParseEhFrame() {
 	for _, section := range o.Sections {
 		if section != nil && section.IsAlive && section.Name() == ".eh_frame" {
+			o.readEhFrame(section)
 			section.IsAlive = false
 		}
 	}
+
+	// SHN_ABS等保留的下标和超出段表的下标都不对应任何输入段
+	getTarget := func(fde *FdeRecord) *InputSection {
+		rel := fde.Rels(o)[0]
+		shndx := o.GetShndx(&o.ElfSyms[rel.Sym], int(rel.Sym))
+		if shndx >= int64(len(o.Sections)) || o.Sections[shndx] == nil {
+			utils.Fatal(&InputError{File: o.File, Msg: ".eh_frame: FDE is not attached to any section"})
+		}
+		return o.Sections[shndx]
+	}
+
+	sort.SliceStable(o.Fdes, func(i, j int) bool {
+		return getTarget(&o.Fdes[i]).Shndx < getTarget(&o.Fdes[j]).Shndx
+	})
+
+	for i := 0; i < len(o.Fdes); {
+		section := getTarget(&o.Fdes[i])
+		section.FdeBegin = uint32(i)
+		for i < len(o.Fdes) && getTarget(&o.Fdes[i]) == section {
+			i++
+		}
+		section.FdeEnd = uint32(i)
+	}
+}
+
+func (o *ObjectFile) readEhFrame(section *InputSection) {
+	fatal := func(msg string) {
+		utils.Fatal(&InputError{File: o.File, Msg: ".eh_frame: " + msg})
+	}
+
+	// 按偏移找出每条记录的重定位，重定位没有排好序时复制一份再排序
+	rels := section.GetRels()
+	byOffset := func(i, j int) bool { return rels[i].Offset < rels[j].Offset }
+	if !sort.SliceIsSorted(rels, byOffset) {
+		rels = slices.Clone(rels)
+		sort.SliceStable(rels, byOffset)
+		section.Rels = rels
+	}
+
+	data := section.Contents
+	cies := make(map[uint32]uint32)
+	relIdx := 0
+
+	for offset := 0; offset < len(data); {
+		size := utils.Read[uint32](data[offset:])
+		if size == 0 {
+			break
+		}
+		if size == 0xffffffff {
+			fatal("64-bit records are not supported")
+		}
+
+		end := offset + 4 + int(size)
+		if end > len(data) {
+			fatal("record extends past the end of the section")
+		}
+
+		relBegin := relIdx
+		for relIdx < len(rels) && rels[relIdx].Offset < uint64(end) {
+			relIdx++
+		}
+
+		// CIE的id为0，FDE的id是从这个字段到它的CIE的距离
+		id := utils.Read[uint32](data[offset+4:])
+		switch {
+		case id == 0:
+			cies[uint32(offset)] = uint32(len(o.Cies))
+			o.Cies = append(o.Cies, CieRecord{
+				File:         o,
+				InputSection: section,
+				InputOffset:  uint32(offset),
+				RelIdx:       uint32(relBegin),
+				RelEnd:       uint32(relIdx),
+			})
+		case relBegin == relIdx:
+			// 没有重定位的FDE不属于任何函数
+		default:
+			if rels[relBegin].Offset != uint64(offset+8) {
+				fatal("FDE's first relocation should have offset 8")
+			}
+			if int(rels[relBegin].Sym) >= len(o.ElfSyms) {
+				fatal("FDE's first relocation has an invalid symbol index")
+			}
+
+			cieIdx, ok := cies[uint32(offset)+4-id]
+			if !ok {
+				fatal("bad FDE pointer")
+			}
+
+			o.Fdes = append(o.Fdes, FdeRecord{
+				InputOffset: uint32(offset),
+				RelIdx:      uint32(relBegin),
+				RelEnd:      uint32(relIdx),
+				CieIdx:      cieIdx,
+				IsAlive:     true,
+			})
+		}
+
+		offset = end
+	}
 }
 
-func (o *ObjectFile) ScanRelocations() {
+func (o *ObjectFile) ScanRelocations(ctx *Context) {
 	for _, section := range o.Sections {
 		if section != nil && section.IsAlive &&
 			section.Shdr().Flags&uint64(elf.SHF_ALLOC) != 0 {
-			section.ScanRelocations()
+			section.ScanRelocations(ctx)
 		}
 	}
 }
@@ -1,9 +1,7 @@
 package linker
 
 import (
-	"bytes"
 	"debug/elf"
-	"encoding/binary"
 	"rvld/pkg/utils"
 )
 
@@ -22,6 +20,14 @@ func NewOutputEhdr() *OutputEhdr {
 }
 
 func GetEntryAddress(ctx *Context) uint64 {
+	if sym, ok := ctx.SymbolMap.Get("_start"); ok && sym.File != nil {
+		return sym.GetAddr(ctx)
+	}
+
+	if ctx.Args.Shared {
+		return 0
+	}
+
 	for _, outputSection := range ctx.OutputSections {
 		if outputSection.Name == ".text" {
 			return outputSection.Shdr.Addr
@@ -51,23 +57,38 @@ func (o *OutputEhdr) CopyBuf(ctx *Context) {
 	ehdr.Ident[elf.EI_VERSION] = uint8(elf.EV_CURRENT)
 	ehdr.Ident[elf.EI_OSABI] = 0
 	ehdr.Ident[elf.EI_ABIVERSION] = 0
-	ehdr.Type = uint16(elf.ET_EXEC)
+	switch {
+	case ctx.Args.Relocatable:
+		ehdr.Type = uint16(elf.ET_REL)
+	case ctx.Args.IsPic():
+		ehdr.Type = uint16(elf.ET_DYN)
+	default:
+		ehdr.Type = uint16(elf.ET_EXEC)
+	}
 	ehdr.Machine = uint16(elf.EM_RISCV)
 	ehdr.Version = uint32(elf.EV_CURRENT)
-	ehdr.Entry = GetEntryAddress(ctx)
 
-	ehdr.PhOff = ctx.Phdr.Shdr.Offset
+	// 可重定位目标文件没有入口地址和程序头
+	if !ctx.Args.Relocatable {
+		ehdr.Entry = GetEntryAddress(ctx)
+		ehdr.PhOff = ctx.Phdr.Shdr.Offset
+		ehdr.PhEntSize = uint16(PhdrSize)
+		ehdr.PhNum = uint16(ctx.Phdr.Shdr.Size) / uint16(PhdrSize)
+	}
+
 	ehdr.ShOff = ctx.Shdr.Shdr.Offset
 	ehdr.Flags = getFlags(ctx)
 	ehdr.EhSize = uint16(EhdrSize)
-	ehdr.PhEntSize = uint16(PhdrSize)
-	ehdr.PhNum = uint16(ctx.Phdr.Shdr.Size) / uint16(PhdrSize)
 
+	// 段太多时，段的个数和.shstrtab的下标存放在第一个段头中
 	ehdr.ShEntSize = uint16(ShdrSize)
-	ehdr.ShNum = uint16(ctx.Shdr.Shdr.Size / uint64(ShdrSize))
+	if shnum := ctx.Shdr.Shdr.Size / uint64(ShdrSize); shnum < uint64(elf.SHN_LORESERVE) {
+		ehdr.ShNum = uint16(shnum)
+	}
+	ehdr.ShStrndx = uint16(ctx.Shstrtab.Shndx)
+	if ctx.Shstrtab.Shndx >= int64(elf.SHN_LORESERVE) {
+		ehdr.ShStrndx = uint16(elf.SHN_XINDEX)
+	}
 
-	buf := &bytes.Buffer{}
-	err := binary.Write(buf, binary.LittleEndian, ehdr)
-	utils.MustNo(err)
-	copy(ctx.Buf[o.Shdr.Offset:], buf.Bytes())
+	utils.Write[Ehdr](ctx.Buf[o.Shdr.Offset:], *ehdr)
 }
@@ -0,0 +1,94 @@
+package linker
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"rvld/pkg/utils"
+)
+
+// 先写到同目录下的临时文件中，全部写完之后再重命名为输出文件，
+// 这样链接失败时不会留下一个不完整的输出文件
+type OutputFile struct {
+	Buf       []byte
+	Path      string
+	file      *os.File
+	isMmapped bool
+	isTemp    bool
+	mappings  *utils.Mappings
+	// 可重定位目标文件不需要可执行权限
+	perm os.FileMode
+}
+
+func OpenOutputFile(ctx *Context, size uint64) *OutputFile {
+	o := &OutputFile{Path: ctx.Args.Output, perm: 0o777, mappings: &ctx.Mappings}
+	if ctx.Args.Relocatable {
+		o.perm = 0o666
+	}
+
+	// 输出到/dev/null这类特殊文件时不能用重命名替换掉它
+	if st, err := os.Stat(o.Path); err == nil && !st.Mode().IsRegular() {
+		file, err := os.OpenFile(o.Path, os.O_WRONLY, 0)
+		utils.MustNo(err)
+		o.file = file
+		o.Buf = make([]byte, size)
+		return o
+	}
+
+	file, err := createTemp(filepath.Dir(o.Path), o.perm)
+	utils.MustNo(err)
+	o.file = file
+	o.isTemp = true
+	ctx.Diag.AddCleanup(o.discard)
+
+	utils.MustNo(file.Truncate(int64(size)))
+	if size > 0 {
+		if buf, err := ctx.Mappings.Mmap(file, int(size), true); err == nil {
+			o.Buf = buf
+			o.isMmapped = true
+			return o
+		}
+	}
+
+	// 不支持mmap的文件系统上先写到内存中，最后一次性写入文件
+	o.Buf = make([]byte, size)
+	return o
+}
+
+// 和os.CreateTemp一样用O_EXCL创建不重名的临时文件，但直接使用最终的权限，由内核去掉umask中的位
+func createTemp(dir string, perm os.FileMode) (*os.File, error) {
+	for {
+		name := filepath.Join(dir, fmt.Sprintf(".rvld-%d", rand.Uint32()))
+		file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, perm)
+		if !os.IsExist(err) {
+			return file, err
+		}
+	}
+}
+
+// 链接失败时丢弃写了一半的临时文件
+func (o *OutputFile) discard() {
+	if o.isMmapped && o.Buf != nil {
+		o.mappings.Munmap(o.Buf)
+	}
+	o.Buf = nil
+	o.file.Close()
+	os.Remove(o.file.Name())
+}
+
+func (o *OutputFile) Close() {
+	if o.isMmapped {
+		utils.MustNo(o.mappings.Munmap(o.Buf))
+	} else {
+		_, err := o.file.Write(o.Buf)
+		utils.MustNo(err)
+	}
+	o.Buf = nil
+
+	utils.MustNo(o.file.Close())
+
+	if o.isTemp {
+		utils.MustNo(os.Rename(o.file.Name(), o.Path))
+	}
+}
@@ -79,6 +79,10 @@ func createPhdr(ctx *Context) []Phdr {
 	}
 
 	define(uint64(elf.PT_PHDR), uint64(elf.PF_R), 8, ctx.Phdr)
+
+	if ctx.Interp != nil {
+		define(uint64(elf.PT_INTERP), uint64(elf.PF_R), 1, ctx.Interp)
+	}
 	end := len(ctx.Chunks)
 	for i := 0; i < end; {
 		first := ctx.Chunks[i]
@@ -115,14 +119,20 @@ func createPhdr(ctx *Context) []Phdr {
 			flags := toPhdrFlags(first)
 			define(uint64(elf.PT_LOAD), uint64(flags), PageSize, first)
 
+			isAlloc := func(chunk Chunker) bool {
+				return chunk.GetShdr().Flags&uint64(elf.SHF_ALLOC) != 0
+			}
+
 			if !isBss(first) {
-				for i < end && !isBss(chunks[i]) && toPhdrFlags(chunks[i]) == flags {
+				for i < end && isAlloc(chunks[i]) && !isBss(chunks[i]) &&
+					toPhdrFlags(chunks[i]) == flags {
 					push(chunks[i])
 					i++
 				}
 			}
 
-			for i < end && isBss(chunks[i]) && toPhdrFlags(chunks[i]) == flags {
+			for i < end && isAlloc(chunks[i]) && isBss(chunks[i]) &&
+				toPhdrFlags(chunks[i]) == flags {
 				push(chunks[i])
 				i++
 			}
@@ -145,7 +155,47 @@ func createPhdr(ctx *Context) []Phdr {
 		ctx.TpAddr = phdr.VAddr
 	}
 
-	return nil
+	if ctx.Dynamic != nil {
+		define(uint64(elf.PT_DYNAMIC), uint64(toPhdrFlags(ctx.Dynamic)), 1, ctx.Dynamic)
+	}
+
+	if ctx.EhFrameHdr != nil && ctx.EhFrameHdr.Shdr.Size > 0 {
+		define(uint64(elf.PT_GNU_EH_FRAME), uint64(elf.PF_R), 1, ctx.EhFrameHdr)
+	}
+
+	{
+		chunks := make([]Chunker, 0)
+		chunks = append(chunks, ctx.Chunks...)
+
+		// tbss不占用地址空间，它的大小不能算到relro区域中
+		chunks = utils.RemoveIf(chunks, func(chunk Chunker) bool {
+			return isTbss(chunk)
+		})
+
+		for i := 0; i < len(chunks); i++ {
+			if !isRelro(ctx, chunks[i]) {
+				continue
+			}
+
+			define(uint64(elf.PT_GNU_RELRO), uint64(elf.PF_R), 1, chunks[i])
+			i++
+			for i < len(chunks) && isRelro(ctx, chunks[i]) {
+				push(chunks[i])
+				i++
+			}
+
+			// 动态链接器只会把完整的页设成只读，SetOutputSectionOffsets已经把后面的段对齐到了页边界
+			phdr := &vec[len(vec)-1]
+			phdr.MemSize = utils.AlignTo(phdr.MemSize, PageSize)
+		}
+	}
+
+	vec = append(vec, Phdr{
+		Type:  uint32(elf.PT_GNU_STACK),
+		Flags: uint32(elf.PF_R | elf.PF_W),
+	})
+
+	return vec
 }
 
 func (o *OutputPhdr) UpdateShdr(ctx *Context) {
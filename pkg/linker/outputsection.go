@@ -6,6 +6,10 @@ type OutputSection struct {
 	Chunk
 	Members []*InputSection
 	Idx     uint32
+
+	// -r时保存这个段的重定位的.rela段，以及这个段的段符号在.symtab中的下标
+	Rela          *RelaSection
+	SectionSymIdx uint32
 }
 
 func NewOutputSection(name string, typ uint32, flags uint64, idx uint32) *OutputSection {
@@ -24,31 +28,67 @@ func (o *OutputSection) CopyBuf(ctx *Context) {
 		return
 	}
 
-	base := ctx.Buf[o.Shdr.Offset:]
+	o.WriteTo(ctx, ctx.Buf[o.Shdr.Offset:])
+}
+
+func (o *OutputSection) WriteTo(ctx *Context, buf []byte) {
 	for _, section := range o.Members {
-		section.WriteTo(ctx, base[section.Offset:])
+		section.WriteTo(ctx, buf[section.Offset:])
 	}
 }
 
+// 每个成员是一个任务
+func (o *OutputSection) CopyJobs(ctx *Context) ([]func(), func()) {
+	if o.Shdr.Type == uint32(elf.SHT_NOBITS) {
+		return nil, nil
+	}
+
+	buf := ctx.Buf[o.Shdr.Offset:]
+	jobs := make([]func(), len(o.Members))
+	for i, section := range o.Members {
+		jobs[i] = func() { section.WriteTo(ctx, buf[section.Offset:]) }
+	}
+	return jobs, nil
+}
+
 func GetOutputSection(ctx *Context, name string, typ uint64, flags uint64) *OutputSection {
 	name = GetOutputName(name, flags)
 	flags = flags & ^uint64(elf.SHF_GROUP) & ^uint64(elf.SHF_MERGE) &
 		^uint64(elf.SHF_STRINGS) & ^uint64(elf.SHF_COMPRESSED)
-	find := func() *OutputSection {
-		for _, outputSection := range ctx.OutputSections {
-			if name == outputSection.Name && typ == uint64(outputSection.Shdr.Type) &&
-				flags == outputSection.Shdr.Flags {
-				return outputSection
-			}
-		}
-		return nil
-	}
-
-	if outputSection := find(); outputSection != nil {
+	key := SectionKey{Name: name, Type: uint32(typ), Flags: flags}
+	if outputSection, ok := ctx.OutputSectionMap[key]; ok {
 		return outputSection
 	}
 
 	outputSection := NewOutputSection(name, uint32(typ), flags, uint32(len(ctx.OutputSections)))
 	ctx.OutputSections = append(ctx.OutputSections, outputSection)
+	ctx.OutputSectionMap[key] = outputSection
+	return outputSection
+}
+
+// -r时只合并名字、类型和标志位都完全相同的段。段组中的段不能和其他段合并，
+// 否则之后的链接丢弃重复的段组时会把其他段一起丢掉
+func GetRelocatableOutputSection(ctx *Context, section *InputSection) *OutputSection {
+	shdr := section.Shdr()
+	// 压缩的输入段在读取时已经解压
+	flags := shdr.Flags & ^uint64(elf.SHF_COMPRESSED)
+	newSection := func() *OutputSection {
+		outputSection := NewOutputSection(section.Name(), shdr.Type, flags,
+			uint32(len(ctx.OutputSections)))
+		ctx.OutputSections = append(ctx.OutputSections, outputSection)
+		return outputSection
+	}
+
+	if flags&uint64(elf.SHF_GROUP) != 0 {
+		return newSection()
+	}
+
+	key := SectionKey{Name: section.Name(), Type: shdr.Type, Flags: flags}
+	if outputSection, ok := ctx.OutputSectionMap[key]; ok {
+		return outputSection
+	}
+
+	outputSection := newSection()
+	ctx.OutputSectionMap[key] = outputSection
 	return outputSection
 }
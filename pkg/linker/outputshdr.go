@@ -1,6 +1,9 @@
 package linker
 
-import "rvld/pkg/utils"
+import (
+	"debug/elf"
+	"rvld/pkg/utils"
+)
 
 type OutputShdr struct {
 	Chunk
@@ -27,7 +30,16 @@ func (o *OutputShdr) UpdateShdr(ctx *Context) {
 
 func (o *OutputShdr) CopyBuf(ctx *Context) {
 	base := ctx.Buf[o.Shdr.Offset:]
-	utils.Write[Shdr](base, Shdr{})
+
+	// e_shnum和e_shstrndx放不下时存放在第一个段头中
+	first := Shdr{}
+	if shnum := o.Shdr.Size / uint64(ShdrSize); shnum >= uint64(elf.SHN_LORESERVE) {
+		first.Size = shnum
+	}
+	if ctx.Shstrtab.Shndx >= int64(elf.SHN_LORESERVE) {
+		first.Link = uint32(ctx.Shstrtab.Shndx)
+	}
+	utils.Write[Shdr](base, first)
 
 	for _, chunk := range ctx.Chunks {
 		if chunk.GetShndx() > 0 {
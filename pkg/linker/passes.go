@@ -2,17 +2,204 @@ package linker
 
 import (
 	"debug/elf"
+	"fmt"
 	"math"
 	"rvld/pkg/utils"
 	"sort"
+	"strings"
 )
 
+// 由链接器定义的符号放在一个虚拟的目标文件中，和普通的符号一样参与符号解析
+func CreateInternalFile(ctx *Context) {
+	obj := &ObjectFile{}
+	obj.File = &File{Name: "<internal>"}
+	obj.IsAlive = true
+	obj.FirstGlobal = 1
+	obj.ElfSyms = []Sym{{}}
+	obj.LocalSymbols = make([]Symbol, 1)
+	obj.LocalSymbols[0].Init("")
+	obj.LocalSymbols[0].File = &obj.InputFile
+	obj.Symbols = []*Symbol{&obj.LocalSymbols[0]}
+
+	// 只定义输入文件中引用到的符号，它们的值在FixSyntheticSymbols中填入
+	defined := make(map[string]bool)
+	define := func(name string, vis elf.SymVis) {
+		if _, ok := ctx.SymbolMap.Get(name); !ok || defined[name] {
+			return
+		}
+		defined[name] = true
+		obj.ElfSyms = append(obj.ElfSyms, Sym{
+			Info:  uint8(elf.STB_GLOBAL) << 4,
+			Other: uint8(vis),
+			Shndx: uint16(elf.SHN_ABS),
+		})
+		obj.Symbols = append(obj.Symbols, GetSymbolByName(ctx, name))
+	}
+
+	if !ctx.Args.Relocatable {
+		// 静态链接时libc通过这两个符号找到需要处理的IRELATIVE重定位
+		define("__rela_iplt_start", elf.STV_HIDDEN)
+		define("__rela_iplt_end", elf.STV_HIDDEN)
+
+		// libc.a中的启动代码通过它们调用构造函数和析构函数
+		for _, name := range []string{"__preinit_array", "__init_array", "__fini_array"} {
+			define(name+"_start", elf.STV_HIDDEN)
+			define(name+"_end", elf.STV_HIDDEN)
+		}
+
+		// 和GNU ld的默认链接脚本提供的符号一致
+		for _, name := range []string{"__ehdr_start", "__executable_start",
+			"_GLOBAL_OFFSET_TABLE_"} {
+			define(name, elf.STV_HIDDEN)
+		}
+		for _, name := range []string{"_etext", "etext", "__etext", "_edata", "edata",
+			"__bss_start", "_end", "end", "__BSS_END__", "__SDATA_BEGIN__",
+			"__global_pointer$"} {
+			define(name, elf.STV_DEFAULT)
+		}
+		if ctx.Args.IsPic() || (!ctx.Args.IsStatic && len(ctx.Dsos) > 0) {
+			define("_DYNAMIC", elf.STV_HIDDEN)
+		}
+
+		// 名字是合法C标识符的段可以通过__start_和__stop_符号找到它的开头和结尾
+		for _, file := range ctx.Objs {
+			for _, section := range file.Sections {
+				if section != nil && isCIdentifier(section.Name()) {
+					define("__start_"+section.Name(), elf.STV_DEFAULT)
+					define("__stop_"+section.Name(), elf.STV_DEFAULT)
+				}
+			}
+		}
+	}
+
+	obj.Symvers = make([]string, len(obj.ElfSyms))
+	ctx.InternalObj = obj
+}
+
+func isCIdentifier(name string) bool {
+	for i, c := range name {
+		if !(c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') ||
+			(i > 0 && '0' <= c && c <= '9')) {
+			return false
+		}
+	}
+	return name != ""
+}
+
 func ResolveSymbols(ctx *Context) {
+	// 之后才被拉进来的归档成员只能覆盖已有的目标文件中的弱定义
+	for i, file := range ctx.Objs {
+		file.Priority = math.MaxInt
+		if file.IsAlive {
+			file.Priority = i
+		}
+	}
+	ctx.InternalObj.Priority = math.MaxInt
+	for i, file := range ctx.Dsos {
+		file.Priority = i
+	}
+
+	live := make([]*ObjectFile, 0)
 	for _, file := range ctx.Objs {
-		file.ResolveSymbols()
+		if file.IsAlive {
+			live = append(live, file)
+		} else {
+			// LazyFiles的顺序决定了拉进来哪个归档成员，所以串行执行
+			file.ResolveLazySymbols()
+		}
 	}
 
+	utils.ParallelFor(ctx.Args.Threads, len(live), func(i int) {
+		live[i].ResolveSymbols()
+	})
+
+	utils.ParallelFor(ctx.Args.Threads, len(ctx.Dsos), func(i int) {
+		ctx.Dsos[i].ResolveSymbols()
+	})
+
 	MarkLiveObjects(ctx)
+
+	// 和链接脚本中的PROVIDE一样，归档成员中的定义优先于链接器定义的符号
+	ctx.InternalObj.ProvideSymbols()
+
+	ctx.InternalObj.MergeVisibility()
+	for _, file := range ctx.Objs {
+		file.MergeVisibility()
+	}
+	// -r时未定义的隐藏符号可以由之后链接的其他目标文件提供
+	if !ctx.Args.Relocatable {
+		for _, file := range ctx.Objs {
+			file.CheckHiddenSymbols(ctx)
+		}
+	}
+
+	if ctx.Args.Shared {
+		for _, file := range ctx.Objs {
+			file.ClaimUnresolvedSymbols()
+		}
+	}
+}
+
+// 两个目标文件中都有同一个符号的强定义时报错
+func CheckDuplicateSymbols(ctx *Context) {
+	for _, file := range ctx.Objs {
+		if !file.IsAlive {
+			continue
+		}
+
+		for i := file.FirstGlobal; i < len(file.ElfSyms); i++ {
+			sym := file.Symbols[i]
+			elfSym := &file.ElfSyms[i]
+			if elfSym.IsUndef() || elfSym.IsWeak() || elfSym.IsCommon() ||
+				(!elfSym.IsAbs() && file.GetSection(elfSym, i) == nil) {
+				continue
+			}
+
+			if sym.File == nil || sym.File.IsDso || sym.File == &file.InputFile {
+				continue
+			}
+
+			if esym := sym.ElfSym(); !esym.IsWeak() && !esym.IsCommon() {
+				ctx.Diag.Error(&DuplicateSymbolError{
+					Name:   sym.Name,
+					First:  sym.File.File,
+					Second: file.File,
+				})
+			}
+		}
+	}
+}
+
+// 可执行文件中不能有未定义的强引用，动态库中的由动态链接器在运行时解析
+func ReportUndefinedSymbols(ctx *Context) {
+	errs := make(map[*Symbol]*UndefinedSymbolError)
+	order := make([]*Symbol, 0)
+
+	for _, file := range ctx.Objs {
+		if !file.IsAlive {
+			continue
+		}
+
+		for i := file.FirstGlobal; i < len(file.ElfSyms); i++ {
+			sym := file.Symbols[i]
+			elfSym := &file.ElfSyms[i]
+			if !elfSym.IsUndef() || elfSym.IsWeak() || sym.File != nil {
+				continue
+			}
+
+			err, ok := errs[sym]
+			if !ok {
+				err = &UndefinedSymbolError{Name: sym.Name}
+				errs[sym] = err
+				order = append(order, sym)
+			}
+			err.Files = append(err.Files, file.File)
+		}
+	}
+
+	for _, sym := range order {
+		ctx.Diag.Error(errs[sym])
+	}
 }
 
 func MarkLiveObjects(ctx *Context) {
@@ -25,18 +212,20 @@ func MarkLiveObjects(ctx *Context) {
 
 	utils.Assert(len(roots) > 0)
 
+	// 不断地把被引用到的归档成员加入进来，直到没有新的成员被拉入，
+	// 这样同一个group中的归档文件会被反复扫描
 	for len(roots) > 0 {
 		file := roots[0]
-		if !file.IsAlive {
-			continue
-		}
+		roots = roots[1:]
 
-		file.MarkLiveObjects(func(of *ObjectFile) {
-			roots = append(roots, file)
+		file.MarkLiveObjects(ctx, func(of *ObjectFile) {
+			roots = append(roots, of)
 		})
-		roots = roots[1:]
 	}
 
+	// 要在删掉没有用到的文件之前输出，这样才能报告归档中没有被拉进来的定义
+	TraceSymbols(ctx)
+
 	for _, file := range ctx.Objs {
 		if !file.IsAlive {
 			file.ClearSymbols()
@@ -46,12 +235,23 @@ func MarkLiveObjects(ctx *Context) {
 	ctx.Objs = utils.RemoveIf[*ObjectFile](ctx.Objs, func(file *ObjectFile) bool {
 		return !file.IsAlive
 	})
+
+	for _, file := range ctx.Dsos {
+		if !file.IsAlive {
+			file.ClearSymbols()
+			delete(ctx.DsoMap, &file.InputFile)
+		}
+	}
+
+	ctx.Dsos = utils.RemoveIf[*SharedFile](ctx.Dsos, func(file *SharedFile) bool {
+		return !file.IsAlive
+	})
 }
 
 func RegisterSectionPieces(ctx *Context) {
-	for _, file := range ctx.Objs {
-		file.RegisterSectionPieces()
-	}
+	utils.ParallelFor(ctx.Args.Threads, len(ctx.Objs), func(i int) {
+		ctx.Objs[i].RegisterSectionPieces()
+	})
 }
 
 func CreateSyntheticSections(ctx *Context) {
@@ -64,16 +264,180 @@ func CreateSyntheticSections(ctx *Context) {
 	ctx.Phdr = push(NewOutputPhdr()).(*OutputPhdr)
 	ctx.Shdr = push(NewOutputShdr()).(*OutputShdr)
 	ctx.Got = push(NewGotSection()).(*GotSection)
+	ctx.Shstrtab = push(NewShstrtabSection()).(*ShstrtabSection)
+	if !ctx.Args.StripAll {
+		ctx.Symtab = push(NewSymtabSection()).(*SymtabSection)
+		ctx.Strtab = push(NewStrtabSection()).(*StrtabSection)
+	}
+
+	ctx.EhFrame = push(NewEhFrameSection()).(*EhFrameSection)
+	if ctx.Args.EhFrameHdr {
+		ctx.EhFrameHdr = push(NewEhFrameHdrSection()).(*EhFrameHdrSection)
+	}
+
+	if !ctx.Args.IsPic() {
+		ctx.Iplt = push(NewIpltSection()).(*IpltSection)
+		ctx.RelIplt = push(NewRelIpltSection()).(*RelIpltSection)
+	}
+
+	if !ctx.Args.IsPic() && (ctx.Args.IsStatic || len(ctx.Dsos) == 0) {
+		return
+	}
+
+	// 静态链接的PIE自己完成重定位，不需要动态链接器；动态库则由加载它的程序指定动态链接器
+	if !ctx.Args.IsStatic && !ctx.Args.Shared {
+		ctx.Interp = push(NewInterpSection()).(*InterpSection)
+	}
+	ctx.Dynamic = push(NewDynamicSection()).(*DynamicSection)
+	ctx.Dynsym = push(NewDynsymSection()).(*DynsymSection)
+	ctx.Dynstr = push(NewDynstrSection()).(*DynstrSection)
+	ctx.Hash = push(NewHashSection()).(*HashSection)
+	ctx.RelDyn = push(NewRelDynSection()).(*RelDynSection)
+	if ctx.Args.PackDynRelocsRelr {
+		ctx.RelrDyn = push(NewRelrDynSection()).(*RelrDynSection)
+	}
+	ctx.Plt = push(NewPltSection()).(*PltSection)
+	ctx.GotPlt = push(NewGotPltSection()).(*GotPltSection)
+	ctx.RelPlt = push(NewRelPltSection()).(*RelPltSection)
+	ctx.Versym = push(NewVersymSection()).(*VersymSection)
+	ctx.Verneed = push(NewVerneedSection()).(*VerneedSection)
+	if len(ctx.Args.VersionDefinitions) > 0 {
+		ctx.Verdef = push(NewVerdefSection()).(*VerdefSection)
+	}
+	ctx.Copyrel = push(NewCopyrelSection(false)).(*CopyrelSection)
+	ctx.CopyrelRelro = push(NewCopyrelSection(true)).(*CopyrelSection)
+
+	for _, file := range ctx.Dsos {
+		ctx.Dynstr.AddString(file.Soname)
+	}
+	if ctx.Args.Soname != "" {
+		ctx.Dynstr.AddString(ctx.Args.Soname)
+	}
+	if len(ctx.Args.Rpaths) > 0 {
+		ctx.Dynstr.AddString(strings.Join(ctx.Args.Rpaths, ":"))
+	}
+}
+
+func ApplyVersionScript(ctx *Context) {
+	for _, file := range ctx.Objs {
+		for i := file.FirstGlobal; i < len(file.ElfSyms); i++ {
+			sym := file.Symbols[i]
+			if sym.File != &file.InputFile || file.ElfSyms[i].IsUndef() {
+				continue
+			}
+
+			ver := file.Symvers[i]
+			if ver == "" {
+				sym.VerIdx = matchVersionPatterns(ctx, sym.Name)
+				continue
+			}
+
+			// foo@VER是非默认版本，动态链接时只能通过带版本的名字引用
+			isDefault := strings.HasPrefix(ver, "@")
+			ver = strings.TrimPrefix(ver, "@")
+
+			idx := getVersionIndex(ctx, ver)
+			if idx == VER_NDX_LOCAL {
+				ctx.Diag.Error(&InputError{File: file.File,
+					Msg: fmt.Sprintf("symbol %s has undefined version %s", sym.Name, ver)})
+				continue
+			}
+			if !isDefault {
+				idx |= VERSYM_HIDDEN
+			}
+			sym.VerIdx = idx
+		}
+	}
+	ctx.Diag.Checkpoint()
+}
+
+func ComputeImportExport(ctx *Context) {
+	for _, file := range ctx.Dsos {
+		for _, sym := range file.Symbols {
+			if sym.File == &file.InputFile {
+				sym.IsImported = true
+			}
+		}
+	}
+
+	if !ctx.Args.Shared {
+		return
+	}
+
+	// 动态库导出所有默认可见性的全局符号，并且这些符号可以被其他模块中的同名定义抢占
+	for _, file := range ctx.Objs {
+		for i := file.FirstGlobal; i < len(file.ElfSyms); i++ {
+			sym := file.Symbols[i]
+			if sym.File != &file.InputFile {
+				continue
+			}
+
+			if sym.IsHidden() || sym.VerIdx == VER_NDX_LOCAL {
+				continue
+			}
+
+			sym.Flags |= NeedsDynsym
+			if sym.ElfSym().IsUndef() {
+				sym.IsImported = true
+				continue
+			}
+
+			// protected符号不能被抢占，对它的引用可以在链接时直接解析
+			sym.IsExported = true
+			if sym.Visibility != elf.STV_PROTECTED {
+				sym.IsImported = true
+			}
+		}
+	}
+}
+
+func ComputeSectionHeaders(ctx *Context) {
+	// 删除空的段，但引用了_GLOBAL_OFFSET_TABLE_时要保留.got，让它有确定的地址
+	keepGot := getProvidedSymbol(ctx, "_GLOBAL_OFFSET_TABLE_") != nil
+	ctx.Chunks = utils.RemoveIf[Chunker](ctx.Chunks, func(chunk Chunker) bool {
+		if keepGot && chunk == Chunker(ctx.Got) {
+			return false
+		}
+		return !isHeader(ctx, chunk) && chunk.GetShdr().Size == 0
+	})
+
+	shndx := int64(1)
+	for _, chunk := range ctx.Chunks {
+		if !isHeader(ctx, chunk) {
+			chunk.SetShndx(shndx)
+			shndx++
+		}
+	}
+
+	for _, chunk := range ctx.Chunks {
+		chunk.UpdateShdr(ctx)
+	}
+}
+
+func isHeader(ctx *Context, chunk Chunker) bool {
+	return chunk == Chunker(ctx.Ehdr) || chunk == Chunker(ctx.Phdr) ||
+		chunk == Chunker(ctx.Shdr)
 }
 
 func SetOutputSectionOffsets(ctx *Context) uint64 {
-	addr := IMAGE_BASE
+	addr := ctx.Args.ImageBase
 
+	var prev Chunker
 	for _, chunk := range ctx.Chunks {
 		if chunk.GetShdr().Flags&uint64(elf.SHF_ALLOC) == 0 {
 			continue
 		}
 
+		// 权限不同的段放在不同的页中，避免映射时相互覆盖
+		if prev != nil && toPhdrFlags(prev) != toPhdrFlags(chunk) {
+			addr = utils.AlignTo(addr, PageSize)
+		}
+		// relro区域结束在页边界上，mprotect时不会把后面可写的数据一起设成只读
+		if prev != nil && isRelro(ctx, prev) && !isRelro(ctx, chunk) {
+			addr = utils.AlignTo(addr, PageSize)
+		}
+		prev = chunk
+
 		addr = utils.AlignTo(addr, chunk.GetShdr().AddrAlign)
 		chunk.GetShdr().Addr = addr
 
@@ -110,21 +474,33 @@ func SetOutputSectionOffsets(ctx *Context) uint64 {
 }
 
 func BinSections(ctx *Context) {
-	group := make([][]*InputSection, len(ctx.OutputSections))
-	for _, file := range ctx.Objs {
-		for _, section := range file.Sections {
-			if section == nil || !section.IsAlive {
-				continue
+	// 把输入文件分成若干片，每片各自分组后再按顺序拼接，成员的顺序仍然是文件的顺序
+	numSlices := min(max(ctx.Args.Threads, 1), max(len(ctx.Objs), 1))
+	groups := make([][][]*InputSection, numSlices)
+	utils.ParallelFor(ctx.Args.Threads, numSlices, func(slice int) {
+		group := make([][]*InputSection, len(ctx.OutputSections))
+		begin := len(ctx.Objs) * slice / numSlices
+		end := len(ctx.Objs) * (slice + 1) / numSlices
+		for _, file := range ctx.Objs[begin:end] {
+			for _, section := range file.Sections {
+				if section == nil || !section.IsAlive {
+					continue
+				}
+
+				idx := section.OutputSection.Idx
+				group[idx] = append(group[idx], section)
 			}
-
-			idx := section.OutputSection.Idx
-			group[idx] = append(group[idx], section)
 		}
-	}
+		groups[slice] = group
+	})
 
-	for idx, section := range ctx.OutputSections {
-		section.Members = group[idx]
-	}
+	utils.ParallelFor(ctx.Args.Threads, len(ctx.OutputSections), func(idx int) {
+		members := make([]*InputSection, 0)
+		for _, group := range groups {
+			members = append(members, group[idx]...)
+		}
+		ctx.OutputSections[idx].Members = members
+	})
 }
 
 func CollectOutputSections(ctx *Context) []Chunker {
@@ -178,9 +554,12 @@ func SortOutputSections(ctx *Context) {
 		if chunk == ctx.Phdr {
 			return 1
 		}
-		if typ == uint32(elf.SHT_NOTE) {
+		if ctx.Interp != nil && chunk == ctx.Interp {
 			return 2
 		}
+		if typ == uint32(elf.SHT_NOTE) {
+			return 3
+		}
 
 		b2i := func(b bool) int {
 			if b {
@@ -192,9 +571,10 @@ func SortOutputSections(ctx *Context) {
 		writeable := b2i(flags&uint64(elf.SHF_WRITE) != 0)
 		notExec := b2i(flags&uint64(elf.SHF_EXECINSTR) == 0)
 		notTls := b2i(flags&uint64(elf.SHF_TLS) == 0)
+		notRelro := b2i(!isRelro(ctx, chunk))
 		isBss := b2i(typ == uint32(elf.SHT_NOBITS))
 
-		return int32(writeable<<7 | notExec<<6 | notTls<<5 | isBss<<4)
+		return int32(writeable<<7 | notExec<<6 | notTls<<5 | notRelro<<4 | isBss<<3)
 	}
 
 	sort.SliceStable(ctx.Chunks, func(i, j int) bool {
@@ -203,37 +583,259 @@ func SortOutputSections(ctx *Context) {
 }
 
 func ComputeMergedSectionSizes(ctx *Context) {
-	for _, section := range ctx.MergedSections {
-		section.AssignOffsets()
-	}
+	utils.ParallelFor(ctx.Args.Threads, len(ctx.MergedSections), func(i int) {
+		ctx.MergedSections[i].AssignOffsets()
+	})
 }
 
 func ScanRelocations(ctx *Context) {
-	for _, file := range ctx.Objs {
-		file.ScanRelocations()
-	}
+	utils.ParallelFor(ctx.Args.Threads, len(ctx.Objs), func(i int) {
+		ctx.Objs[i].ScanRelocations(ctx)
+	})
+	ctx.Diag.Checkpoint()
 
 	syms := make([]*Symbol, 0)
-	for _, file := range ctx.Objs {
+	collect := func(file *InputFile) {
 		for _, sym := range file.Symbols {
-			if sym.File == file && sym.Flags != 0 {
+			if sym != nil && sym.File == file && sym.Flags != 0 {
 				syms = append(syms, sym)
 			}
 		}
 	}
 
+	for _, file := range ctx.Objs {
+		collect(&file.InputFile)
+	}
+	for _, file := range ctx.Dsos {
+		collect(&file.InputFile)
+	}
+
 	for _, sym := range syms {
+		if sym.Flags&NeedsDynsym != 0 {
+			ctx.Dynsym.AddSymbol(ctx, sym)
+		}
+
+		if sym.Flags&NeedsGot != 0 {
+			ctx.Got.AddGotSymbol(sym)
+		}
+
 		if sym.Flags&NeedsGotTp != 0 {
 			ctx.Got.AddGotTpSymbol(sym)
 		}
 
+		if sym.Flags&NeedsTlsGd != 0 {
+			ctx.Got.AddTlsGdSymbol(sym)
+		}
+
+		if sym.Flags&NeedsPlt != 0 {
+			ctx.Plt.AddSymbol(ctx, sym)
+		}
+
+		if sym.Flags&NeedsIplt != 0 {
+			ctx.Iplt.AddSymbol(ctx, sym)
+		}
+
+		if sym.Flags&NeedsCanonicalPlt != 0 {
+			sym.IsCanonical = true
+		}
+
+		if sym.Flags&NeedsCopyrel != 0 {
+			file := findSharedFile(ctx, sym.File)
+			if file.IsReadonly(sym) {
+				ctx.CopyrelRelro.AddSymbol(ctx, file, sym)
+			} else {
+				ctx.Copyrel.AddSymbol(ctx, file, sym)
+			}
+		}
+
 		sym.Flags = 0
 	}
 }
 
+func ConstructVersionSections(ctx *Context) {
+	if ctx.Verdef != nil {
+		ctx.Verdef.Construct(ctx)
+	}
+	if ctx.Verneed != nil {
+		ctx.Verneed.Construct(ctx)
+	}
+}
+
+func ConstructEhFrame(ctx *Context) {
+	ctx.EhFrame.Construct(ctx)
+}
+
+func ComputeSymtab(ctx *Context) {
+	if ctx.Symtab != nil {
+		ctx.Symtab.Construct(ctx)
+	}
+}
+
+// 段的内容要在地址确定之后才能生成，压缩后非alloc段的大小变了，需要重新计算文件偏移
+func CompressDebugSections(ctx *Context) {
+	utils.ParallelFor(ctx.Args.Threads, len(ctx.Chunks), func(i int) {
+		chunk := ctx.Chunks[i]
+		shdr := chunk.GetShdr()
+		if w, ok := chunk.(sectionWriter); ok && shdr.Flags&uint64(elf.SHF_ALLOC) == 0 &&
+			shdr.Size > 0 && strings.HasPrefix(chunk.GetName(), ".debug") {
+			ctx.Chunks[i] = NewCompressedSection(ctx, w)
+		}
+	})
+}
+
+// 把所有Chunk的写入放在同一层ParallelFor中，而不是在Chunk的CopyBuf中再嵌套一层。
+// 输出段和.eh_frame按成员或输入文件拆成多个任务，这样大的段不会拖慢整体
+func CopyChunks(ctx *Context) {
+	var jobs []func()
+	var finishers []func()
+	for _, chunk := range ctx.Chunks {
+		if c, ok := chunk.(splitChunker); ok {
+			chunkJobs, finish := c.CopyJobs(ctx)
+			jobs = append(jobs, chunkJobs...)
+			if finish != nil {
+				finishers = append(finishers, finish)
+			}
+			continue
+		}
+		jobs = append(jobs, func() { chunk.CopyBuf(ctx) })
+	}
+
+	utils.ParallelFor(ctx.Args.Threads, len(jobs), func(i int) {
+		jobs[i]()
+	})
+	for _, finish := range finishers {
+		finish()
+	}
+}
+
+// 链接器定义的符号的值要等到确定了各个段的地址之后才能知道
+func FixSyntheticSymbols(ctx *Context) {
+	set := func(name string, val uint64) {
+		if sym := getProvidedSymbol(ctx, name); sym != nil {
+			sym.Value = val
+		}
+	}
+
+	// 输出文件中没有对应的段时，开始和结束符号的值相同
+	setRange := func(prefix string, chunk Chunker) {
+		if chunk != nil {
+			shdr := chunk.GetShdr()
+			set(prefix+"_start", shdr.Addr)
+			set(prefix+"_end", shdr.Addr+shdr.Size)
+		}
+	}
+
+	if ctx.RelIplt != nil {
+		setRange("__rela_iplt", ctx.RelIplt)
+	}
+	setRange("__preinit_array", findChunk(ctx, ".preinit_array"))
+	setRange("__init_array", findChunk(ctx, ".init_array"))
+	setRange("__fini_array", findChunk(ctx, ".fini_array"))
+
+	for _, osec := range ctx.OutputSections {
+		if isCIdentifier(osec.Name) {
+			set("__start_"+osec.Name, osec.Shdr.Addr)
+			set("__stop_"+osec.Name, osec.Shdr.Addr+osec.Shdr.Size)
+		}
+	}
+
+	set("__ehdr_start", ctx.Ehdr.Shdr.Addr)
+	set("__executable_start", ctx.Ehdr.Shdr.Addr)
+	set("_GLOBAL_OFFSET_TABLE_", ctx.Got.Shdr.Addr)
+	if ctx.Dynamic != nil {
+		set("_DYNAMIC", ctx.Dynamic.Shdr.Addr)
+	}
+
+	// 代码段、已初始化的数据段和所有段的结尾，.tbss不占用地址空间
+	var etext, edata, end, bssStart uint64
+	for _, chunk := range ctx.Chunks {
+		shdr := chunk.GetShdr()
+		if shdr.Flags&uint64(elf.SHF_ALLOC) == 0 || isTbss(chunk) {
+			continue
+		}
+
+		if shdr.Flags&uint64(elf.SHF_EXECINSTR) != 0 {
+			etext = max(etext, shdr.Addr+shdr.Size)
+		}
+		if shdr.Type != uint32(elf.SHT_NOBITS) {
+			edata = max(edata, shdr.Addr+shdr.Size)
+		} else if bssStart == 0 {
+			bssStart = shdr.Addr
+		}
+		end = max(end, shdr.Addr+shdr.Size)
+	}
+	if bssStart == 0 {
+		bssStart = edata
+	}
+
+	for _, name := range []string{"_etext", "etext", "__etext"} {
+		set(name, etext)
+	}
+	for _, name := range []string{"_edata", "edata"} {
+		set(name, edata)
+	}
+	for _, name := range []string{"_end", "end", "__BSS_END__"} {
+		set(name, end)
+	}
+	set("__bss_start", bssStart)
+
+	// 和lld一样，gp指向.sdata往后0x800字节处，这样用12位的偏移就可以访问整个.sdata
+	sdata := Chunker(ctx.Ehdr)
+	if chunk := findChunk(ctx, ".sdata"); chunk != nil {
+		sdata = chunk
+	}
+	set("__SDATA_BEGIN__", sdata.GetShdr().Addr)
+	set("__global_pointer$", sdata.GetShdr().Addr+0x800)
+}
+
+// 返回由链接器定义的符号，没有被引用或者由输入文件定义时返回nil
+func getProvidedSymbol(ctx *Context, name string) *Symbol {
+	if sym, ok := ctx.SymbolMap.Get(name); ok && sym.File == &ctx.InternalObj.InputFile {
+		return sym
+	}
+	return nil
+}
+
+func findChunk(ctx *Context, name string) Chunker {
+	for _, chunk := range ctx.Chunks {
+		if chunk.GetName() == name && !isHeader(ctx, chunk) {
+			return chunk
+		}
+	}
+	return nil
+}
+
+func findSharedFile(ctx *Context, file *InputFile) *SharedFile {
+	dso, ok := ctx.DsoMap[file]
+	if !ok {
+		utils.Fatal(&InputError{File: file.File, Msg: "not a shared file"})
+	}
+	return dso
+}
+
 // tls段中也分data和bss段
 func isTbss(chunk Chunker) bool {
 	shdr := chunk.GetShdr()
 	return shdr.Type == uint32(elf.SHT_NOBITS) &&
 		shdr.Flags&uint64(elf.SHF_TLS) != 0
 }
+
+// 只在加载时被动态链接器改写的数据，重定位完成后就可以设成只读
+func isRelro(ctx *Context, chunk Chunker) bool {
+	shdr := chunk.GetShdr()
+	if !ctx.Args.ZRelro || shdr.Flags&uint64(elf.SHF_WRITE) == 0 {
+		return false
+	}
+
+	switch shdr.Type {
+	case uint32(elf.SHT_INIT_ARRAY), uint32(elf.SHT_FINI_ARRAY),
+		uint32(elf.SHT_PREINIT_ARRAY):
+		return true
+	}
+
+	// -z now时所有PLT表项在启动时就已经绑定，.got.plt不会再被改写
+	return shdr.Flags&uint64(elf.SHF_TLS) != 0 ||
+		chunk == Chunker(ctx.Got) || chunk == Chunker(ctx.Dynamic) ||
+		(ctx.Args.ZNow && chunk == Chunker(ctx.GotPlt)) ||
+		strings.HasSuffix(chunk.GetName(), ".rel.ro")
+}
@@ -0,0 +1,77 @@
+package linker
+
+import (
+	"debug/elf"
+	"rvld/pkg/utils"
+)
+
+const PltHdrSize uint64 = 32
+const PltEntrySize uint64 = 16
+
+type PltSection struct {
+	Chunk
+	Symbols []*Symbol
+}
+
+func NewPltSection() *PltSection {
+	p := &PltSection{Chunk: NewChunk()}
+	p.Name = ".plt"
+	p.Shdr.Type = uint32(elf.SHT_PROGBITS)
+	p.Shdr.Flags = uint64(elf.SHF_ALLOC | elf.SHF_EXECINSTR)
+	p.Shdr.AddrAlign = 16
+	return p
+}
+
+func (p *PltSection) AddSymbol(ctx *Context, sym *Symbol) {
+	if sym.PltIdx != -1 {
+		return
+	}
+
+	sym.PltIdx = int32(len(p.Symbols))
+	p.Symbols = append(p.Symbols, sym)
+	ctx.Dynsym.AddSymbol(ctx, sym)
+}
+
+func (p *PltSection) UpdateShdr(ctx *Context) {
+	if len(p.Symbols) == 0 {
+		p.Shdr.Size = 0
+		return
+	}
+	p.Shdr.Size = PltHdrSize + uint64(len(p.Symbols))*PltEntrySize
+}
+
+var pltHdr = []uint32{
+	0x0000_0397, // auipc  t2, %pcrel_hi(.got.plt)
+	0x41c3_0333, // sub    t1, t1, t3               # .plt entry + hdr + 12
+	0x0003_be03, // ld     t3, %pcrel_lo(1b)(t2)    # _dl_runtime_resolve
+	0xfd43_0313, // addi   t1, t1, -44              # .plt entry
+	0x0003_8293, // addi   t0, t2, %pcrel_lo(1b)    # &.got.plt
+	0x0013_5313, // srli   t1, t1, 1                # .got.plt entry offset
+	0x0082_b283, // ld     t0, 8(t0)                # link map
+	0x000e_0067, // jr     t3
+}
+
+var pltEntry = []uint32{
+	0x0000_0e17, // auipc   t3, %pcrel_hi(function@.got.plt)
+	0x000e_3e03, // ld      t3, %pcrel_lo(1b)(t3)
+	0x000e_0367, // jalr    t1, t3
+	0x0000_0013, // nop
+}
+
+func (p *PltSection) CopyBuf(ctx *Context) {
+	base := ctx.Buf[p.Shdr.Offset:]
+
+	utils.Write(base, pltHdr)
+	disp := uint32(ctx.GotPlt.Shdr.Addr - p.Shdr.Addr)
+	writeUtype(base, disp)
+	writeItype(base[8:], disp)
+	writeItype(base[16:], disp)
+
+	for _, sym := range p.Symbols {
+		ent := base[PltHdrSize+uint64(sym.PltIdx)*PltEntrySize:]
+		utils.Write(ent, pltEntry)
+		disp := uint32(sym.GetGotPltAddr(ctx) - sym.GetPltAddr(ctx))
+		writeUtype(ent, disp)
+		writeItype(ent[4:], disp)
+	}
+}
@@ -0,0 +1,75 @@
+package linker
+
+import (
+	"debug/elf"
+	"fmt"
+	"rvld/pkg/utils"
+)
+
+// -r时输出段的重定位，偏移改为相对于输出段，符号改为输出的.symtab中的符号
+type RelaSection struct {
+	Chunk
+	OutputSection *OutputSection
+}
+
+func NewRelaSection(outputSection *OutputSection) *RelaSection {
+	r := &RelaSection{Chunk: NewChunk(), OutputSection: outputSection}
+	r.Name = ".rela" + outputSection.Name
+	r.Shdr.Type = uint32(elf.SHT_RELA)
+	r.Shdr.Flags = uint64(elf.SHF_INFO_LINK) |
+		outputSection.Shdr.Flags&uint64(elf.SHF_GROUP)
+	r.Shdr.EntSize = uint64(RelaSize)
+	r.Shdr.AddrAlign = 8
+
+	for _, member := range outputSection.Members {
+		r.Shdr.Size += uint64(len(member.GetRels())) * uint64(RelaSize)
+	}
+	return r
+}
+
+func (r *RelaSection) UpdateShdr(ctx *Context) {
+	r.Shdr.Link = uint32(ctx.Symtab.Shndx)
+	r.Shdr.Info = uint32(r.OutputSection.Shndx)
+}
+
+func (r *RelaSection) CopyBuf(ctx *Context) {
+	base := ctx.Buf[r.Shdr.Offset:]
+	for _, member := range r.OutputSection.Members {
+		file := member.File
+		for _, rel := range member.GetRels() {
+			inputSym := rel.Sym
+			rel.Offset += uint64(member.Offset)
+
+			// 段符号换成输出段的段符号，加数加上输入段在输出段中的偏移
+			esym := &file.ElfSyms[rel.Sym]
+			if esym.Type() == uint8(elf.STT_SECTION) {
+				section := file.GetSection(esym, int(rel.Sym))
+				if section != nil && section.IsAlive {
+					rel.Addend += int64(section.Offset)
+					rel.Sym = section.OutputSection.SectionSymIdx
+				} else {
+					rel.Sym = 0
+				}
+			} else {
+				rel.Sym = file.OutputSymIndices[rel.Sym]
+			}
+
+			// 引用的符号没有输出时不能悄悄改成引用0号符号
+			if inputSym != 0 && rel.Sym == 0 {
+				msg := "relocation refers to a discarded section: " +
+					file.sectionName(esym, int(inputSym))
+				if esym.Type() != uint8(elf.STT_SECTION) {
+					msg = "relocation refers to a symbol in a discarded section: " +
+						file.Symbols[inputSym].Name
+				}
+				ctx.Diag.Error(&InputError{
+					File: file.File,
+					Msg:  fmt.Sprintf("%s+0x%x: %s", member.Name(), rel.Offset-uint64(member.Offset), msg),
+				})
+			}
+
+			utils.Write[Rela](base, rel)
+			base = base[RelaSize:]
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package linker
+
+import "debug/elf"
+
+type RelDynSection struct {
+	Chunk
+}
+
+func NewRelDynSection() *RelDynSection {
+	r := &RelDynSection{Chunk: NewChunk()}
+	r.Name = ".rela.dyn"
+	r.Shdr.Type = uint32(elf.SHT_RELA)
+	r.Shdr.Flags = uint64(elf.SHF_ALLOC)
+	r.Shdr.EntSize = uint64(RelaSize)
+	r.Shdr.AddrAlign = 8
+	return r
+}
+
+func (r *RelDynSection) UpdateShdr(ctx *Context) {
+	// 依次是GOT、.copyrel和各个InputSection的动态重定位
+	offset := uint64(ctx.Got.GetNumDynrels(ctx)) * uint64(RelaSize)
+
+	for _, copyrel := range []*CopyrelSection{ctx.Copyrel, ctx.CopyrelRelro} {
+		copyrel.RelDynOffset = offset
+		offset += uint64(len(copyrel.Symbols)) * uint64(RelaSize)
+	}
+	for _, file := range ctx.Objs {
+		for _, section := range file.Sections {
+			if section == nil || !section.IsAlive || section.NumDynrel == 0 {
+				continue
+			}
+
+			section.RelDynOffset = offset
+			offset += uint64(section.NumDynrel) * uint64(RelaSize)
+		}
+	}
+
+	r.Shdr.Size = offset
+	r.Shdr.Link = uint32(ctx.Dynsym.Shndx)
+}
@@ -0,0 +1,119 @@
+package linker
+
+import (
+	"debug/elf"
+	"rvld/pkg/utils"
+)
+
+// -r把所有输入的目标文件合并成一个可重定位目标文件，既不分配地址也不生成动态链接相关的段，
+// 重定位原样保留给之后的链接处理
+
+// 有些段不能简单地拼接起来
+func FixRelocatableOutputSections(ctx *Context) {
+	for _, osec := range ctx.OutputSections {
+		if len(osec.Members) == 0 {
+			continue
+		}
+
+		switch osec.Shdr.Type {
+		case SHT_RISCV_ATTRIBUTES:
+			// 每个属性段都以版本号开头，拼接之后就无法解析了，所以合并成一个放在第一个成员中
+			if len(osec.Members) > 1 {
+				first := osec.Members[0]
+				first.Contents = mergeRiscvAttributes(ctx, osec.Members)
+				first.ShSize = uint32(len(first.Contents))
+				for _, member := range osec.Members[1:] {
+					member.IsAlive = false
+				}
+				osec.Members = osec.Members[:1]
+			}
+		case SHT_LLVM_ADDRSIG:
+			// 其中存放的是输入文件中的符号下标，输出之后就失效了
+			for _, member := range osec.Members {
+				member.IsAlive = false
+			}
+			osec.Members = nil
+			continue
+		}
+
+		// 可合并的段的表项大小必须一致，否则只能当作普通的段
+		entSize := osec.Members[0].Shdr().EntSize
+		for _, member := range osec.Members[1:] {
+			if member.Shdr().EntSize != entSize {
+				entSize = 0
+				osec.Shdr.Flags &^= uint64(elf.SHF_MERGE | elf.SHF_STRINGS)
+				break
+			}
+		}
+		osec.Shdr.EntSize = entSize
+	}
+}
+
+func CreateRelocatableSections(ctx *Context) {
+	ctx.Ehdr = NewOutputEhdr()
+	ctx.Shdr = NewOutputShdr()
+	ctx.Shstrtab = NewShstrtabSection()
+	ctx.Symtab = NewSymtabSection()
+	ctx.Strtab = NewStrtabSection()
+
+	// 和汇编器一样，段组放在它的成员之前
+	ctx.Chunks = []Chunker{ctx.Ehdr}
+	for _, file := range ctx.Objs {
+		for i := range file.ElfSections {
+			if shdr := &file.ElfSections[i]; shdr.Type == uint32(elf.SHT_GROUP) {
+				ctx.Chunks = append(ctx.Chunks, NewGroupSection(file, shdr))
+			}
+		}
+	}
+
+	// 每个输出段的重定位紧跟在它的后面
+	for _, chunk := range CollectOutputSections(ctx) {
+		ctx.Chunks = append(ctx.Chunks, chunk)
+		osec, ok := chunk.(*OutputSection)
+		if !ok {
+			continue
+		}
+
+		for _, member := range osec.Members {
+			if len(member.GetRels()) > 0 {
+				osec.Rela = NewRelaSection(osec)
+				ctx.Chunks = append(ctx.Chunks, osec.Rela)
+				break
+			}
+		}
+	}
+
+	ctx.Chunks = append(ctx.Chunks, ctx.Symtab)
+	if len(ctx.Chunks) >= int(elf.SHN_LORESERVE) {
+		ctx.Chunks = append(ctx.Chunks, NewSymtabShndxSection())
+	}
+	ctx.Chunks = append(ctx.Chunks, ctx.Strtab, ctx.Shstrtab, ctx.Shdr)
+
+	// -r时不删除空的段，例如.note.GNU-stack仅仅存在就有意义
+	shndx := int64(1)
+	for _, chunk := range ctx.Chunks {
+		if !isHeader(ctx, chunk) {
+			chunk.SetShndx(shndx)
+			shndx++
+		}
+	}
+
+	ctx.Symtab.ConstructRelocatable(ctx)
+	for _, chunk := range ctx.Chunks {
+		chunk.UpdateShdr(ctx)
+	}
+}
+
+// 可重定位目标文件中没有程序头，段的地址都是0，按顺序排列在文件中即可
+func SetRelocatableOffsets(ctx *Context) uint64 {
+	fileOff := uint64(0)
+	for _, chunk := range ctx.Chunks {
+		shdr := chunk.GetShdr()
+		fileOff = utils.AlignTo(fileOff, shdr.AddrAlign)
+		shdr.Offset = fileOff
+		if shdr.Type != uint32(elf.SHT_NOBITS) {
+			fileOff += shdr.Size
+		}
+	}
+	return fileOff
+}
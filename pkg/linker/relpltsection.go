@@ -0,0 +1,37 @@
+package linker
+
+import (
+	"debug/elf"
+	"rvld/pkg/utils"
+)
+
+type RelPltSection struct {
+	Chunk
+}
+
+func NewRelPltSection() *RelPltSection {
+	r := &RelPltSection{Chunk: NewChunk()}
+	r.Name = ".rela.plt"
+	r.Shdr.Type = uint32(elf.SHT_RELA)
+	r.Shdr.Flags = uint64(elf.SHF_ALLOC | elf.SHF_INFO_LINK)
+	r.Shdr.EntSize = uint64(RelaSize)
+	r.Shdr.AddrAlign = 8
+	return r
+}
+
+func (r *RelPltSection) UpdateShdr(ctx *Context) {
+	r.Shdr.Size = uint64(len(ctx.Plt.Symbols)) * uint64(RelaSize)
+	r.Shdr.Link = uint32(ctx.Dynsym.Shndx)
+	r.Shdr.Info = uint32(ctx.GotPlt.Shndx)
+}
+
+func (r *RelPltSection) CopyBuf(ctx *Context) {
+	base := ctx.Buf[r.Shdr.Offset:]
+	for _, sym := range ctx.Plt.Symbols {
+		utils.Write[Rela](base[int(sym.PltIdx)*RelaSize:], Rela{
+			Offset: sym.GetGotPltAddr(ctx),
+			Type:   uint32(elf.R_RISCV_JUMP_SLOT),
+			Sym:    uint32(sym.DynsymIdx),
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package linker
+
+import (
+	"debug/elf"
+	"rvld/pkg/utils"
+	"sort"
+)
+
+type RelrDynSection struct {
+	Chunk
+}
+
+func NewRelrDynSection() *RelrDynSection {
+	r := &RelrDynSection{Chunk: NewChunk()}
+	r.Name = ".relr.dyn"
+	r.Shdr.Type = SHT_RELR
+	r.Shdr.Flags = uint64(elf.SHF_ALLOC)
+	r.Shdr.EntSize = 8
+	r.Shdr.AddrAlign = 8
+	return r
+}
+
+// 每个输出段中需要R_RISCV_RELATIVE重定位的地址，
+// 同一个段中地址之间的差值是固定的，所以编码后的长度和段的地址无关
+func collectRelrs(ctx *Context) [][]uint64 {
+	vec := make([][]uint64, 0)
+	for _, osec := range ctx.OutputSections {
+		addrs := make([]uint64, 0)
+		for _, isec := range osec.Members {
+			for _, offset := range isec.Relrs {
+				addrs = append(addrs, osec.Shdr.Addr+uint64(isec.Offset)+offset)
+			}
+		}
+
+		if len(addrs) > 0 {
+			sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+			vec = append(vec, addrs)
+		}
+	}
+
+	addrs := make([]uint64, 0)
+	for _, entry := range ctx.Got.GetEntries(ctx) {
+		if entry.IsRelr(ctx) {
+			addrs = append(addrs, ctx.Got.Shdr.Addr+uint64(entry.Idx)*8)
+		}
+	}
+	if len(addrs) > 0 {
+		vec = append(vec, addrs)
+	}
+
+	return vec
+}
+
+// 每个地址项之后跟着若干个位图，位图中的第i位表示地址项之后第i个字需要重定位
+func encodeRelr(addrs []uint64) []uint64 {
+	ret := make([]uint64, 0)
+	for i := 0; i < len(addrs); {
+		ret = append(ret, addrs[i])
+		base := addrs[i] + 8
+		i++
+
+		for {
+			bits := uint64(0)
+			for i < len(addrs) && addrs[i]-base < 63*8 {
+				bits |= 1 << ((addrs[i] - base) / 8)
+				i++
+			}
+
+			if bits == 0 {
+				break
+			}
+			ret = append(ret, bits<<1|1)
+			base += 63 * 8
+		}
+	}
+	return ret
+}
+
+func (r *RelrDynSection) UpdateShdr(ctx *Context) {
+	n := 0
+	for _, addrs := range collectRelrs(ctx) {
+		n += len(encodeRelr(addrs))
+	}
+	r.Shdr.Size = uint64(n) * 8
+}
+
+func (r *RelrDynSection) CopyBuf(ctx *Context) {
+	base := ctx.Buf[r.Shdr.Offset:]
+	for _, addrs := range collectRelrs(ctx) {
+		words := encodeRelr(addrs)
+		utils.Write(base, words)
+		base = base[len(words)*8:]
+	}
+}
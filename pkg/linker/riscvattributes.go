@@ -0,0 +1,272 @@
+package linker
+
+import (
+	"fmt"
+	"regexp"
+	"rvld/pkg/utils"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// .riscv.attributes以版本号'A'开头，之后是按厂商划分的子段，RISC-V自己的属性在"riscv"子段的
+// Tag_File部分中。属性的标签是ULEB128，偶数标签的值是ULEB128，奇数标签的值是字符串。
+// -r时不能把多个属性段直接拼接起来，只能解析之后合并成一个
+
+const (
+	tagFile              = 1
+	tagRiscvStackAlign   = 4
+	tagRiscvArch         = 5
+	tagRiscvUnalignedAcc = 6
+)
+
+type riscvAttribute struct {
+	Num uint64
+	Str string
+}
+
+type riscvAttributes map[uint64]riscvAttribute
+
+func attributeName(tag uint64) string {
+	switch tag {
+	case tagRiscvStackAlign:
+		return "Tag_RISCV_stack_align"
+	case tagRiscvArch:
+		return "Tag_RISCV_arch"
+	case tagRiscvUnalignedAcc:
+		return "Tag_RISCV_unaligned_access"
+	}
+	return fmt.Sprintf("attribute tag %d", tag)
+}
+
+func readNtbs(data []byte) (string, []byte) {
+	end := strings.IndexByte(string(data), 0)
+	if end < 0 {
+		return "", nil
+	}
+	return string(data[:end]), data[end+1:]
+}
+
+func skipUleb(data []byte) []byte {
+	for i, b := range data {
+		if b&0x80 == 0 {
+			return data[i+1:]
+		}
+	}
+	return nil
+}
+
+func parseRiscvAttributes(isec *InputSection) riscvAttributes {
+	fatal := func() {
+		utils.Fatal(&InputError{File: isec.File.File, Msg: isec.Name() + ": corrupted section"})
+	}
+
+	data := isec.Contents
+	if len(data) == 0 || data[0] != 'A' {
+		fatal()
+	}
+	data = data[1:]
+
+	attrs := riscvAttributes{}
+	for len(data) > 0 {
+		if len(data) < 4 {
+			fatal()
+		}
+		size := utils.Read[uint32](data)
+		if size < 4 || int(size) > len(data) {
+			fatal()
+		}
+		sub := data[4:size]
+		data = data[size:]
+
+		vendor, sub := readNtbs(sub)
+		if vendor != "riscv" {
+			continue
+		}
+
+		for len(sub) > 0 {
+			if len(sub) < 5 {
+				fatal()
+			}
+			tag := sub[0]
+			size := utils.Read[uint32](sub[1:])
+			if size < 5 || int(size) > len(sub) {
+				fatal()
+			}
+			body := sub[5:size]
+			sub = sub[size:]
+
+			// 只针对部分段或符号的属性很少见，合并时忽略
+			if tag != tagFile {
+				continue
+			}
+
+			for len(body) > 0 {
+				tag := utils.ReadUleb(body)
+				if body = skipUleb(body); body == nil {
+					fatal()
+				}
+
+				if tag%2 == 0 {
+					attrs[tag] = riscvAttribute{Num: utils.ReadUleb(body)}
+					body = skipUleb(body)
+				} else {
+					var str string
+					str, body = readNtbs(body)
+					attrs[tag] = riscvAttribute{Str: str}
+				}
+				if body == nil {
+					fatal()
+				}
+			}
+		}
+	}
+	return attrs
+}
+
+// 扩展在ISA字符串中的规范顺序：先是单字母扩展，然后依次是Z、S、X开头的多字母扩展，
+// Z扩展再按照第二个字母所属的单字母扩展排序
+const riscvExtensionOrder = "iemafdqlcbkjtpvnh"
+
+func extensionRank(name string) int {
+	rank := func(c byte) int {
+		if i := strings.IndexByte(riscvExtensionOrder, c); i >= 0 {
+			return i
+		}
+		return len(riscvExtensionOrder)
+	}
+
+	if len(name) == 1 {
+		return rank(name[0])
+	}
+	switch name[0] {
+	case 'z':
+		return 100 + rank(name[1])
+	case 's':
+		return 200
+	}
+	return 300
+}
+
+var extensionRe = regexp.MustCompile(`^([a-z][a-z0-9]*?)(\d+)?(?:p(\d+))?$`)
+
+type riscvExtension struct {
+	Major, Minor int
+}
+
+// 解析形如rv64i2p1_m2p0_zicsr2p0的ISA字符串
+func parseRiscvArch(arch string) (string, map[string]riscvExtension, bool) {
+	if len(arch) < 5 || (!strings.HasPrefix(arch, "rv32") && !strings.HasPrefix(arch, "rv64")) {
+		return "", nil, false
+	}
+
+	exts := map[string]riscvExtension{}
+	for _, tok := range strings.Split(arch[4:], "_") {
+		m := extensionRe.FindStringSubmatch(tok)
+		if m == nil {
+			return "", nil, false
+		}
+		major, _ := strconv.Atoi(m[2])
+		minor, _ := strconv.Atoi(m[3])
+		exts[m[1]] = riscvExtension{major, minor}
+	}
+	return arch[:4], exts, true
+}
+
+// 取两个ISA字符串中扩展的并集，同一个扩展取较高的版本
+func mergeRiscvArch(a, b string) (string, error) {
+	xlen1, exts1, ok1 := parseRiscvArch(a)
+	xlen2, exts2, ok2 := parseRiscvArch(b)
+	if !ok1 || !ok2 {
+		return "", fmt.Errorf("invalid Tag_RISCV_arch: %s, %s", a, b)
+	}
+	if xlen1 != xlen2 {
+		return "", fmt.Errorf("conflicting Tag_RISCV_arch: %s vs %s", a, b)
+	}
+
+	for name, ext := range exts2 {
+		if old, ok := exts1[name]; !ok || old.Major < ext.Major ||
+			(old.Major == ext.Major && old.Minor < ext.Minor) {
+			exts1[name] = ext
+		}
+	}
+
+	names := make([]string, 0, len(exts1))
+	for name := range exts1 {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		ri, rj := extensionRank(names[i]), extensionRank(names[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return names[i] < names[j]
+	})
+
+	for i, name := range names {
+		names[i] = fmt.Sprintf("%s%dp%d", name, exts1[name].Major, exts1[name].Minor)
+	}
+	return xlen1 + strings.Join(names, "_"), nil
+}
+
+func mergeRiscvAttributes(ctx *Context, members []*InputSection) []byte {
+	merged := riscvAttributes{}
+	sources := map[uint64]*InputSection{}
+
+	for _, member := range members {
+		for tag, attr := range parseRiscvAttributes(member) {
+			old, ok := merged[tag]
+			if !ok {
+				merged[tag] = attr
+				sources[tag] = member
+				continue
+			}
+
+			switch tag {
+			case tagRiscvStackAlign, tagRiscvUnalignedAcc:
+				attr.Num = max(attr.Num, old.Num)
+			case tagRiscvArch:
+				arch, err := mergeRiscvArch(old.Str, attr.Str)
+				if err != nil {
+					ctx.Diag.Error(fmt.Errorf("%s: %v", member.File.File, err))
+					continue
+				}
+				attr.Str = arch
+			default:
+				if attr != old {
+					ctx.Diag.Error(fmt.Errorf("%s: %s conflicts with %s",
+						member.File.File, attributeName(tag), sources[tag].File.File))
+					continue
+				}
+			}
+			merged[tag] = attr
+		}
+	}
+
+	tags := make([]uint64, 0, len(merged))
+	for tag := range merged {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+
+	var attrs []byte
+	for _, tag := range tags {
+		attrs = utils.AppendUleb(attrs, tag)
+		if tag%2 == 0 {
+			attrs = utils.AppendUleb(attrs, merged[tag].Num)
+		} else {
+			attrs = append(attrs, merged[tag].Str...)
+			attrs = append(attrs, 0)
+		}
+	}
+
+	// 'A'，子段长度，"riscv"，Tag_File，Tag_File部分的长度，属性
+	vendor := "riscv\x00"
+	buf := make([]byte, 1+4+len(vendor)+5, 1+4+len(vendor)+5+len(attrs))
+	buf[0] = 'A'
+	utils.Write[uint32](buf[1:], uint32(4+len(vendor)+5+len(attrs)))
+	copy(buf[5:], vendor)
+	buf[5+len(vendor)] = tagFile
+	utils.Write[uint32](buf[6+len(vendor):], uint32(5+len(attrs)))
+	return append(buf, attrs...)
+}
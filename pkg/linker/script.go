@@ -0,0 +1,183 @@
+package linker
+
+import (
+	"fmt"
+	"path/filepath"
+	"rvld/pkg/utils"
+	"strings"
+)
+
+func tokenizeScript(contents string) []string {
+	tokens := make([]string, 0)
+	for len(contents) > 0 {
+		if strings.HasPrefix(contents, "/*") {
+			end := strings.Index(contents[2:], "*/")
+			if end == -1 {
+				utils.Fatal("unclosed comment in linker script")
+			}
+			contents = contents[end+4:]
+			continue
+		}
+
+		if strings.HasPrefix(contents, "#") {
+			end := strings.IndexByte(contents, '\n')
+			if end == -1 {
+				end = len(contents)
+			}
+			contents = contents[end:]
+			continue
+		}
+
+		c := contents[0]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			contents = contents[1:]
+		case c == '"':
+			end := strings.IndexByte(contents[1:], '"')
+			if end == -1 {
+				utils.Fatal("unclosed string literal in linker script")
+			}
+			tokens = append(tokens, contents[1:end+1])
+			contents = contents[end+2:]
+		case strings.IndexByte("(),;:{}=", c) != -1:
+			tokens = append(tokens, contents[:1])
+			contents = contents[1:]
+		default:
+			end := strings.IndexAny(contents, " \t\n\r\"(),;:{}=")
+			if end == -1 {
+				end = len(contents)
+			}
+			tokens = append(tokens, contents[:end])
+			contents = contents[end:]
+		}
+	}
+
+	return tokens
+}
+
+func skipParens(tokens []string) []string {
+	if len(tokens) == 0 || tokens[0] != "(" {
+		utils.Fatal("expected ( in linker script")
+	}
+
+	depth := 0
+	for i, tok := range tokens {
+		if tok == "(" {
+			depth++
+		} else if tok == ")" {
+			depth--
+			if depth == 0 {
+				return tokens[i+1:]
+			}
+		}
+	}
+
+	utils.Fatal("unbalanced ( in linker script")
+	return nil
+}
+
+func ParseLinkerScript(ctx *Context, file *File) {
+	tokens := tokenizeScript(string(file.Contents))
+	for len(tokens) > 0 {
+		switch tokens[0] {
+		case "OUTPUT_FORMAT":
+			tokens = skipParens(tokens[1:])
+		case "SEARCH_DIR":
+			tokens = readSearchDir(ctx, file, tokens[1:])
+		case "INPUT":
+			// INPUT和在命令行上直接列出这些文件一样，沿用当前的group状态
+			tokens = readScriptFileList(ctx, file, tokens[1:])
+		case "GROUP":
+			// GROUP中的文件和--start-group/--end-group一样会被反复扫描
+			inGroup := ctx.Reader.InGroup
+			ctx.Reader.InGroup = true
+			tokens = readScriptFileList(ctx, file, tokens[1:])
+			ctx.Reader.InGroup = inGroup
+		case ";":
+			tokens = tokens[1:]
+		default:
+			utils.Fatal(fmt.Sprintf("%s: unknown linker script token: %s",
+				file.Name, tokens[0]))
+		}
+	}
+}
+
+func readSearchDir(ctx *Context, script *File, tokens []string) []string {
+	// =是分隔符，SEARCH_DIR(=/usr/lib)会被拆成两个记号
+	if len(tokens) > 2 && tokens[1] == "=" {
+		tokens = append([]string{tokens[0], "=" + tokens[2]}, tokens[3:]...)
+	}
+
+	if len(tokens) < 3 || tokens[0] != "(" || tokens[2] != ")" {
+		utils.Fatal(fmt.Sprintf("%s: expected SEARCH_DIR(path)", script.Name))
+	}
+
+	path := filepath.Clean(ResolveSysrootPath(ctx, tokens[1]))
+	ctx.Args.LibraryPaths = append(ctx.Args.LibraryPaths, path)
+	return tokens[3:]
+}
+
+func readScriptFileList(ctx *Context, script *File, tokens []string) []string {
+	if len(tokens) == 0 || tokens[0] != "(" {
+		utils.Fatal(fmt.Sprintf("%s: expected (", script.Name))
+	}
+	tokens = tokens[1:]
+
+	for len(tokens) > 0 && tokens[0] != ")" {
+		if tokens[0] == "," {
+			tokens = tokens[1:]
+		} else if tokens[0] == "AS_NEEDED" {
+			asNeeded := ctx.Reader.AsNeeded
+			ctx.Reader.AsNeeded = true
+			tokens = readScriptFileList(ctx, script, tokens[1:])
+			ctx.Reader.AsNeeded = asNeeded
+		} else if tokens[0] == "-l" && len(tokens) > 2 && tokens[1] == ":" {
+			// :是分隔符，-l:libfoo.a会被拆成三个记号
+			ReadFile(ctx, findScriptFile(ctx, script, "-l:"+tokens[2]))
+			tokens = tokens[3:]
+		} else {
+			ReadFile(ctx, findScriptFile(ctx, script, tokens[0]))
+			tokens = tokens[1:]
+		}
+	}
+
+	if len(tokens) == 0 {
+		utils.Fatal(fmt.Sprintf("%s: expected )", script.Name))
+	}
+	return tokens[1:]
+}
+
+func findScriptFile(ctx *Context, script *File, path string) *File {
+	if name, ok := utils.RemovePrefix(path, "-l"); ok {
+		return FindLibrary(ctx, name)
+	}
+
+	path = ResolveSysrootPath(ctx, path)
+
+	// sysroot中的链接脚本里的绝对路径是相对于sysroot的
+	if ctx.Args.Sysroot != "" && filepath.IsAbs(path) &&
+		strings.HasPrefix(script.Name, ctx.Args.Sysroot) {
+		if f := OpenLibrary(ctx, filepath.Join(ctx.Args.Sysroot, path)); f != nil {
+			return f
+		}
+	}
+
+	if f := OpenLibrary(ctx, path); f != nil {
+		return f
+	}
+
+	if !filepath.IsAbs(path) {
+		if f := OpenLibrary(ctx, filepath.Join(filepath.Dir(script.Name), path)); f != nil {
+			return f
+		}
+
+		for _, dir := range ctx.Args.LibraryPaths {
+			if f := OpenLibrary(ctx, dir+"/"+path); f != nil {
+				return f
+			}
+		}
+	}
+
+	utils.Fatal(fmt.Sprintf("%s: cannot find %s", script.Name, path))
+	return nil
+}
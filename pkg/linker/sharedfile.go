@@ -0,0 +1,184 @@
+package linker
+
+import (
+	"debug/elf"
+	"math/bits"
+	"path/filepath"
+	"rvld/pkg/utils"
+)
+
+type SharedFile struct {
+	InputFile
+	Soname         string
+	Versyms        []uint16
+	VersionStrings []string
+}
+
+func NewSharedFile(file *File) *SharedFile {
+	s := &SharedFile{InputFile: NewInputFile(file)}
+	s.IsDso = true
+	s.IsAlive = true
+	return s
+}
+
+func (s *SharedFile) Parse(ctx *Context) {
+	s.Soname = s.getSoname()
+
+	dynsymSec := s.FindSection(uint32(elf.SHT_DYNSYM))
+	if dynsymSec == nil {
+		return
+	}
+
+	s.FillUpElfSyms(dynsymSec)
+	s.SymbolStrtab = s.GetBytesFromIdx(int64(dynsymSec.Link))
+	s.VersionStrings = s.readVerdef()
+
+	versyms := make([]uint16, 0)
+	if sec := s.FindSection(uint32(elf.SHT_GNU_VERSYM)); sec != nil {
+		versyms = utils.ReadSlice[uint16](s.GetBytesFromShdr(sec), 2)
+	}
+
+	// 只保留动态库中定义的全局符号
+	elfSyms := make([]Sym, 0)
+	keys := make([]string, 0)
+	for i := int(dynsymSec.Info); i < len(s.ElfSyms); i++ {
+		elfSym := &s.ElfSyms[i]
+		if elfSym.IsUndef() {
+			continue
+		}
+
+		ver := VER_NDX_GLOBAL
+		if len(versyms) > 0 {
+			ver = versyms[i]
+		}
+		if ver == VER_NDX_LOCAL {
+			continue
+		}
+
+		name := ElfGetName(s.SymbolStrtab, elfSym.Name)
+
+		// 非默认版本的符号(foo@VER)只能通过带版本的名字引用
+		if ver&VERSYM_HIDDEN == 0 {
+			elfSyms = append(elfSyms, *elfSym)
+			s.Versyms = append(s.Versyms, ver)
+			keys = append(keys, name)
+		}
+
+		if idx := int(ver &^ VERSYM_HIDDEN); idx > int(VER_NDX_GLOBAL) &&
+			idx < len(s.VersionStrings) {
+			elfSyms = append(elfSyms, *elfSym)
+			s.Versyms = append(s.Versyms, ver)
+			keys = append(keys, name+"@"+s.VersionStrings[idx])
+		}
+	}
+
+	s.ElfSyms = elfSyms
+	s.FirstGlobal = 0
+	s.Symbols = make([]*Symbol, 0, len(elfSyms))
+	for i := 0; i < len(elfSyms); i++ {
+		name := ElfGetName(s.SymbolStrtab, elfSyms[i].Name)
+		s.Symbols = append(s.Symbols, GetVersionedSymbol(ctx, keys[i], name))
+	}
+}
+
+func (s *SharedFile) getSoname() string {
+	if sec := s.FindSection(uint32(elf.SHT_DYNAMIC)); sec != nil {
+		strtab := s.GetBytesFromIdx(int64(sec.Link))
+		for _, dyn := range utils.ReadSlice[Dyn](s.GetBytesFromShdr(sec), DynSize) {
+			if dyn.Tag == int64(elf.DT_SONAME) {
+				return ElfGetName(strtab, uint32(dyn.Val))
+			}
+		}
+	}
+
+	return filepath.Base(s.File.Name)
+}
+
+// 版本号下标对应的版本字符串，例如GLIBC_2.27
+func (s *SharedFile) readVerdef() []string {
+	sec := s.FindSection(uint32(elf.SHT_GNU_VERDEF))
+	if sec == nil {
+		return nil
+	}
+
+	contents := s.GetBytesFromShdr(sec)
+	strtab := s.GetBytesFromIdx(int64(sec.Link))
+	ret := make([]string, 0)
+
+	offset := uint64(0)
+	for {
+		verdef := utils.Read[Verdef](contents[offset:])
+		for int(verdef.Ndx) >= len(ret) {
+			ret = append(ret, "")
+		}
+
+		verdaux := utils.Read[Verdaux](contents[offset+uint64(verdef.Aux):])
+		ret[verdef.Ndx] = ElfGetName(strtab, verdaux.Name)
+
+		if verdef.Next == 0 {
+			break
+		}
+		offset += uint64(verdef.Next)
+	}
+
+	return ret
+}
+
+// 符号在动态库中的版本字符串，没有版本时返回空字符串
+func (s *SharedFile) GetVersion(sym *Symbol) string {
+	ver := int(s.Versyms[sym.SymIdx] &^ VERSYM_HIDDEN)
+	if ver <= int(VER_NDX_GLOBAL) || ver >= len(s.VersionStrings) {
+		return ""
+	}
+	return s.VersionStrings[ver]
+}
+
+func (s *SharedFile) ResolveSymbols() {
+	for i := 0; i < len(s.ElfSyms); i++ {
+		sym := s.Symbols[i]
+		sym.mu.Lock()
+		if sym.File == nil || (sym.File.IsDso && sym.File.Priority > s.Priority) {
+			sym.File = &s.InputFile
+			sym.SetInputSection(nil)
+			sym.Value = s.ElfSyms[i].Val
+			sym.SymIdx = i
+		}
+		sym.mu.Unlock()
+	}
+}
+
+// 找出和sym地址相同的所有符号，例如environ和__environ
+func (s *SharedFile) FindAliases(sym *Symbol) []*Symbol {
+	esym := sym.ElfSym()
+	aliases := make([]*Symbol, 0)
+	for i := 0; i < len(s.ElfSyms); i++ {
+		elfSym := &s.ElfSyms[i]
+		if s.Symbols[i].File == &s.InputFile &&
+			elfSym.Shndx == esym.Shndx && elfSym.Val == esym.Val {
+			aliases = append(aliases, s.Symbols[i])
+		}
+	}
+	return aliases
+}
+
+func (s *SharedFile) IsReadonly(sym *Symbol) bool {
+	shndx := sym.ElfSym().Shndx
+	if int(shndx) >= len(s.ElfSections) {
+		return false
+	}
+	return s.ElfSections[shndx].Flags&uint64(elf.SHF_WRITE) == 0
+}
+
+func (s *SharedFile) GetAlignment(sym *Symbol) uint64 {
+	esym := sym.ElfSym()
+	align := uint64(1)
+	if int(esym.Shndx) < len(s.ElfSections) {
+		align = max(s.ElfSections[esym.Shndx].AddrAlign, 1)
+	}
+
+	// 符号地址本身的对齐也限制了它的对齐要求
+	if esym.Val != 0 {
+		align = min(align, uint64(1)<<bits.TrailingZeros64(esym.Val))
+	}
+	return align
+}
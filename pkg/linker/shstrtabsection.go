@@ -0,0 +1,37 @@
+package linker
+
+import "debug/elf"
+
+type ShstrtabSection struct {
+	Chunk
+}
+
+func NewShstrtabSection() *ShstrtabSection {
+	s := &ShstrtabSection{Chunk: NewChunk()}
+	s.Name = ".shstrtab"
+	s.Shdr.Type = uint32(elf.SHT_STRTAB)
+	return s
+}
+
+func (s *ShstrtabSection) UpdateShdr(ctx *Context) {
+	offset := uint64(1)
+	for _, chunk := range ctx.Chunks {
+		if chunk.GetShndx() > 0 {
+			chunk.GetShdr().Name = uint32(offset)
+			offset += uint64(len(chunk.GetName())) + 1
+		}
+	}
+	s.Shdr.Size = offset
+}
+
+func (s *ShstrtabSection) CopyBuf(ctx *Context) {
+	base := ctx.Buf[s.Shdr.Offset:]
+	base[0] = 0
+	for _, chunk := range ctx.Chunks {
+		if chunk.GetShndx() > 0 {
+			name := chunk.GetName()
+			copy(base[chunk.GetShdr().Name:], name)
+			base[chunk.GetShdr().Name+uint32(len(name))] = 0
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package linker
+
+import "debug/elf"
+
+type StrtabSection struct {
+	Chunk
+	Strings []string
+	Offsets map[string]uint32
+}
+
+func NewStrtabSection() *StrtabSection {
+	s := &StrtabSection{
+		Chunk:   NewChunk(),
+		Offsets: make(map[string]uint32),
+	}
+	s.Name = ".strtab"
+	s.Shdr.Type = uint32(elf.SHT_STRTAB)
+	s.Shdr.Size = 1
+	return s
+}
+
+func (s *StrtabSection) AddString(str string) uint32 {
+	if offset, ok := s.Offsets[str]; ok {
+		return offset
+	}
+
+	offset := uint32(s.Shdr.Size)
+	s.Offsets[str] = offset
+	s.Strings = append(s.Strings, str)
+	s.Shdr.Size += uint64(len(str)) + 1
+	return offset
+}
+
+func (s *StrtabSection) CopyBuf(ctx *Context) {
+	base := ctx.Buf[s.Shdr.Offset:]
+	base[0] = 0
+	for _, str := range s.Strings {
+		offset := s.Offsets[str]
+		copy(base[offset:], str)
+		base[offset+uint32(len(str))] = 0
+	}
+}
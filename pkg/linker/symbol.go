@@ -1,29 +1,96 @@
 package linker
 
-import "rvld/pkg/utils"
+import (
+	"debug/elf"
+	"rvld/pkg/utils"
+	"sync"
+	"sync/atomic"
+)
 
 const (
-	NeedsGotTp uint32 = 1 << 0
+	NeedsGotTp  uint32 = 1 << 0
+	NeedsGot    uint32 = 1 << 1
+	NeedsDynsym uint32 = 1 << 2
+	NeedsPlt    uint32 = 1 << 3
+
+	NeedsCanonicalPlt uint32 = 1 << 4
+	NeedsCopyrel      uint32 = 1 << 5
+	NeedsTlsGd        uint32 = 1 << 6
+	NeedsIplt         uint32 = 1 << 7
 )
 
 type Symbol struct {
-	File     *ObjectFile
-	Name     string
-	Value    uint64
-	SymIdx   int
-	GotTpIdx int32
+	// 并行解析符号时保护File等字段
+	mu sync.Mutex
+
+	File       *InputFile
+	Name       string
+	Value      uint64
+	SymIdx     int
+	GotIdx     int32
+	GotTpIdx   int32
+	TlsGdIdx   int32
+	PltIdx     int32
+	IpltIdx    int32
+	IpltGotIdx int32
+	DynsymIdx  int32
+	VerIdx     uint16
 
 	InputSection    *InputSection
 	SectionFragment *SectionFragment
 
+	// 定义了该符号但尚未被链接进来的归档成员，按命令行顺序排列
+	LazyFiles []*ObjectFile
+
 	Flags uint32
+
+	// 所有目标文件中对该符号声明的可见性中限制最严格的那个
+	Visibility elf.SymVis
+
+	// 定义在动态库中，或者是动态库中可以被抢占的符号，需要在运行时由动态链接器解析
+	IsImported bool
+	// 需要出现在输出文件的.dynsym中供其他模块引用
+	IsExported bool
+	// 可执行文件中该函数的地址就是它的PLT表项的地址
+	IsCanonical bool
+	// 动态库中的数据被复制到了可执行文件的.copyrel段中，此时Value是在该段中的偏移
+	HasCopyrel        bool
+	IsCopyrelReadonly bool
+	// 类型为STT_GNU_IFUNC，符号的值是解析函数的地址
+	IsIfunc bool
 }
 
 func NewSymbol(name string) *Symbol {
-	s := &Symbol{Name: name, SymIdx: -1}
+	s := &Symbol{}
+	s.Init(name)
 	return s
 }
 
+func (s *Symbol) Init(name string) {
+	*s = Symbol{
+		Name:       name,
+		SymIdx:     -1,
+		GotIdx:     -1,
+		GotTpIdx:   -1,
+		TlsGdIdx:   -1,
+		PltIdx:     -1,
+		IpltIdx:    -1,
+		IpltGotIdx: -1,
+		DynsymIdx:  -1,
+		VerIdx:     VER_NDX_GLOBAL,
+	}
+}
+
+// 扫描重定位时多个线程可能同时设置同一个符号的标志位
+func (s *Symbol) AddFlags(flags uint32) {
+	for {
+		old := atomic.LoadUint32(&s.Flags)
+		if old&flags == flags || atomic.CompareAndSwapUint32(&s.Flags, old, old|flags) {
+			return
+		}
+	}
+}
+
 func (s *Symbol) SetInputSection(section *InputSection) {
 	s.InputSection = section
 	s.SectionFragment = nil
@@ -34,12 +101,38 @@ func (s *Symbol) SetSectionFragment(frag *SectionFragment) {
 	s.InputSection = nil
 }
 
-func GetSymbolByName(ctx *Context, name string) *Symbol {
-	if sym, ok := ctx.SymbolMap[name]; ok {
-		return sym
+func (s *Symbol) MergeVisibility(vis elf.SymVis) {
+	priority := func(vis elf.SymVis) int {
+		switch vis {
+		case elf.STV_INTERNAL:
+			return 1
+		case elf.STV_HIDDEN:
+			return 2
+		case elf.STV_PROTECTED:
+			return 3
+		}
+		return 4
+	}
+
+	if priority(vis) < priority(s.Visibility) {
+		s.Visibility = vis
 	}
-	ctx.SymbolMap[name] = NewSymbol(name)
-	return ctx.SymbolMap[name]
+}
+
+// 隐藏的符号不会被导出，在输出文件中是本地符号
+func (s *Symbol) IsHidden() bool {
+	return s.Visibility == elf.STV_HIDDEN || s.Visibility == elf.STV_INTERNAL
+}
+
+func GetSymbolByName(ctx *Context, name string) *Symbol {
+	return GetVersionedSymbol(ctx, name, name)
+}
+
+// 带版本的符号foo@VER以完整的名字作为键，但它在输出文件中的名字仍然是foo
+func GetVersionedSymbol(ctx *Context, key string, name string) *Symbol {
+	return ctx.SymbolMap.GetOrInsert(key, func() *Symbol {
+		return NewSymbol(name)
+	})
 }
 
 func (s *Symbol) ElfSym() *Sym {
@@ -53,18 +146,126 @@ func (s *Symbol) Clear() {
 	s.SymIdx = -1
 }
 
-func (s *Symbol) GetAddr() uint64 {
+func (s *Symbol) GetAddr(ctx *Context) uint64 {
+	// 取IFUNC的地址时得到的是它的.iplt表项，保证函数指针的比较结果一致
+	if s.IpltIdx != -1 {
+		return s.GetIpltAddr(ctx)
+	}
+
+	if s.PltIdx != -1 {
+		return s.GetPltAddr(ctx)
+	}
+	return s.GetDefinedAddr(ctx)
+}
+
+// 符号定义处的地址，不经过PLT
+func (s *Symbol) GetDefinedAddr(ctx *Context) uint64 {
+	if s.HasCopyrel {
+		if s.IsCopyrelReadonly {
+			return ctx.CopyrelRelro.Shdr.Addr + s.Value
+		}
+		return ctx.Copyrel.Shdr.Addr + s.Value
+	}
+
 	if s.SectionFragment != nil {
 		return s.SectionFragment.GetAddr() + s.Value
 	}
 
 	if s.InputSection != nil {
+		if !s.InputSection.IsAlive && s.InputSection.Name() == ".eh_frame" {
+			return s.getEhFrameAddr(ctx)
+		}
 		return s.InputSection.GetAddr() + s.Value
 	}
 
 	return s.Value
 }
 
+// 输入的.eh_frame被拆开重新生成了，指向其中某条记录的符号要换算到这条记录在输出中的位置。
+// 不在任何记录中的符号只可能指向段的开头、末尾或者长度为0的终止记录，
+// 例如crtbegin.o中的__EH_FRAME_BEGIN__和crtend.o中的__FRAME_END__
+func (s *Symbol) getEhFrameAddr(ctx *Context) uint64 {
+	section := s.InputSection
+	file := section.File
+	offset := uint32(s.Value)
+	contains := func(begin uint32, size int) bool {
+		return begin <= offset && offset < begin+uint32(size)
+	}
+
+	for i := range file.Cies {
+		cie := &file.Cies[i]
+		if cie.InputSection == section && contains(cie.InputOffset, len(cie.Contents())) {
+			return ctx.EhFrame.Shdr.Addr + uint64(cie.Offset+offset-cie.InputOffset)
+		}
+	}
+
+	for i := range file.Fdes {
+		fde := &file.Fdes[i]
+		if fde.Cie(file).InputSection != section ||
+			!contains(fde.InputOffset, len(fde.Contents(file))) {
+			continue
+		}
+
+		if !fde.IsAlive {
+			ctx.Diag.Error(&InputError{
+				File: file.File,
+				Msg:  "symbol " + s.Name + " refers to a discarded .eh_frame record",
+			})
+			return 0
+		}
+		return ctx.EhFrame.Shdr.Addr + uint64(fde.OutputOffset+offset-fde.InputOffset)
+	}
+
+	switch {
+	case offset < uint32(len(section.Contents)) && ctx.EhFrame.Shdr.Size > 0:
+		return ctx.EhFrame.Shdr.Addr + ctx.EhFrame.Shdr.Size - 4
+	case offset == 0:
+		return ctx.EhFrame.Shdr.Addr
+	default:
+		return ctx.EhFrame.Shdr.Addr + ctx.EhFrame.Shdr.Size
+	}
+}
+
+// 符号所在的输出段的下标，指向输入.eh_frame的符号属于重新生成的.eh_frame
+func (s *Symbol) GetOutputShndx(ctx *Context) int64 {
+	if s.SectionFragment != nil {
+		return s.SectionFragment.OutputSection.Shndx
+	}
+
+	if s.InputSection != nil {
+		if !s.InputSection.IsAlive && s.InputSection.Name() == ".eh_frame" {
+			return ctx.EhFrame.Shndx
+		}
+		return s.InputSection.OutputSection.Shndx
+	}
+
+	return int64(elf.SHN_ABS)
+}
+
+func (s *Symbol) GetPltAddr(ctx *Context) uint64 {
+	return ctx.Plt.Shdr.Addr + PltHdrSize + uint64(s.PltIdx)*PltEntrySize
+}
+
+func (s *Symbol) GetGotPltAddr(ctx *Context) uint64 {
+	return ctx.GotPlt.Shdr.Addr + GotPltHdrSize + uint64(s.PltIdx)*8
+}
+
+func (s *Symbol) GetIpltAddr(ctx *Context) uint64 {
+	return ctx.Iplt.Shdr.Addr + uint64(s.IpltIdx)*PltEntrySize
+}
+
+func (s *Symbol) GetIpltGotAddr(ctx *Context) uint64 {
+	return ctx.Got.Shdr.Addr + uint64(s.IpltGotIdx)*8
+}
+
+func (s *Symbol) GetGotAddr(ctx *Context) uint64 {
+	return ctx.Got.Shdr.Addr + uint64(s.GotIdx)*8
+}
+
 func (s *Symbol) GetGotTpAddr(ctx *Context) uint64 {
 	return ctx.Got.Shdr.Addr + uint64(s.GotTpIdx)*8
 }
+
+func (s *Symbol) GetTlsGdAddr(ctx *Context) uint64 {
+	return ctx.Got.Shdr.Addr + uint64(s.TlsGdIdx)*8
+}
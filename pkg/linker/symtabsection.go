@@ -0,0 +1,234 @@
+package linker
+
+import (
+	"debug/elf"
+	"fmt"
+	"rvld/pkg/utils"
+	"strings"
+)
+
+type SymtabSection struct {
+	Chunk
+	Symbols []*Symbol
+	// -r时输出的符号，已经换算成了输出文件中的段和偏移。
+	// st_shndx为SHN_XINDEX的符号的段下标存放在Xindices中
+	Entries  []Sym
+	Xindices []uint32
+}
+
+func NewSymtabSection() *SymtabSection {
+	s := &SymtabSection{Chunk: NewChunk()}
+	s.Name = ".symtab"
+	s.Shdr.Type = uint32(elf.SHT_SYMTAB)
+	s.Shdr.EntSize = uint64(SymSize)
+	s.Shdr.AddrAlign = 8
+	return s
+}
+
+func isLocalSymbolOutput(sym *Symbol) bool {
+	esym := sym.ElfSym()
+	if esym.Type() == uint8(elf.STT_SECTION) || strings.HasPrefix(sym.Name, ".L") {
+		return false
+	}
+
+	if sym.InputSection != nil {
+		return sym.InputSection.IsAlive
+	}
+	return sym.SectionFragment != nil || esym.IsAbs()
+}
+
+// 本地符号必须排在全局符号之前，sh_info是第一个全局符号的下标
+func (s *SymtabSection) Construct(ctx *Context) {
+	s.Symbols = make([]*Symbol, 0)
+	for _, file := range ctx.Objs {
+		for i := 1; i < file.FirstGlobal; i++ {
+			if isLocalSymbolOutput(file.Symbols[i]) {
+				s.Symbols = append(s.Symbols, file.Symbols[i])
+			}
+		}
+	}
+
+	files := append([]*ObjectFile{}, ctx.Objs...)
+	files = append(files, ctx.InternalObj)
+
+	// 隐藏的全局符号在输出文件中变成本地符号
+	for _, file := range files {
+		for _, sym := range file.Symbols[file.FirstGlobal:] {
+			if sym.File == &file.InputFile && sym.IsHidden() {
+				s.Symbols = append(s.Symbols, sym)
+			}
+		}
+	}
+
+	s.Shdr.Info = uint32(len(s.Symbols) + 1)
+
+	seen := make(map[*Symbol]bool)
+	for _, file := range files {
+		for _, sym := range file.Symbols[file.FirstGlobal:] {
+			if sym.File == nil || sym.IsHidden() || seen[sym] {
+				continue
+			}
+
+			if sym.File == &file.InputFile || sym.File.IsDso {
+				seen[sym] = true
+				s.Symbols = append(s.Symbols, sym)
+			}
+		}
+	}
+
+	for _, sym := range s.Symbols {
+		ctx.Strtab.AddString(sym.Name)
+	}
+	s.Shdr.Size = uint64(len(s.Symbols)+1) * uint64(SymSize)
+}
+
+// -r时保留所有的本地符号，每个输出段各有一个段符号，全局符号不论是否有定义都要输出
+func (s *SymtabSection) ConstructRelocatable(ctx *Context) {
+	// 定义在输出段中的符号传入段的下标，否则shndx为-1，保留esym中原来的值
+	add := func(name string, esym Sym, shndx int64) uint32 {
+		if name != "" {
+			esym.Name = ctx.Strtab.AddString(name)
+		}
+
+		xindex := uint32(0)
+		if shndx >= int64(elf.SHN_LORESERVE) {
+			esym.Shndx = uint16(elf.SHN_XINDEX)
+			xindex = uint32(shndx)
+		} else if shndx >= 0 {
+			esym.Shndx = uint16(shndx)
+		}
+
+		s.Entries = append(s.Entries, esym)
+		s.Xindices = append(s.Xindices, xindex)
+		return uint32(len(s.Entries))
+	}
+
+	// 输入文件中定义在段中的符号的值要加上输入段在输出段中的偏移
+	addInputSym := func(file *ObjectFile, idx int, name string) uint32 {
+		esym := file.ElfSyms[idx]
+		if esym.IsAbs() || esym.IsCommon() || esym.IsUndef() {
+			return add(name, esym, -1)
+		}
+
+		section := file.GetSection(&esym, idx)
+		if section == nil || !section.IsAlive {
+			return 0
+		}
+		esym.Val += uint64(section.Offset)
+		return add(name, esym, section.OutputSection.Shndx)
+	}
+
+	for _, osec := range ctx.OutputSections {
+		if len(osec.Members) > 0 {
+			osec.SectionSymIdx = add("", Sym{
+				Info: uint8(elf.STB_LOCAL)<<4 | uint8(elf.STT_SECTION),
+			}, osec.Shndx)
+		}
+	}
+
+	for _, file := range ctx.Objs {
+		file.OutputSymIndices = make([]uint32, len(file.ElfSyms))
+		for i := 1; i < file.FirstGlobal; i++ {
+			esym := &file.ElfSyms[i]
+			if esym.Type() == uint8(elf.STT_SECTION) {
+				if section := file.GetSection(esym, i); section != nil && section.IsAlive {
+					file.OutputSymIndices[i] = section.OutputSection.SectionSymIdx
+				}
+				continue
+			}
+			file.OutputSymIndices[i] = addInputSym(file, i, file.Symbols[i].Name)
+		}
+	}
+
+	s.Shdr.Info = uint32(len(s.Entries) + 1)
+
+	objs := make(map[*InputFile]*ObjectFile)
+	for _, file := range ctx.Objs {
+		objs[&file.InputFile] = file
+	}
+
+	// 符号名用输入文件中的原始名字，这样foo@VER这样的版本信息不会丢失
+	seen := make(map[*Symbol]uint32)
+	for _, file := range ctx.Objs {
+		for i := file.FirstGlobal; i < len(file.ElfSyms); i++ {
+			sym := file.Symbols[i]
+			esym := &file.ElfSyms[i]
+
+			if idx, ok := seen[sym]; ok {
+				file.OutputSymIndices[i] = idx
+				// 只有所有的引用都是弱引用时，未定义的符号才是弱符号
+				if sym.File == nil && !esym.IsWeak() {
+					out := &s.Entries[idx-1]
+					out.Info = uint8(elf.STB_GLOBAL)<<4 | out.Type()
+				}
+				continue
+			}
+
+			var idx uint32
+			if sym.File == nil {
+				idx = addInputSym(file, i, ElfGetName(file.SymbolStrtab, esym.Name))
+			} else {
+				def := objs[sym.File]
+				idx = addInputSym(def, sym.SymIdx, ElfGetName(def.SymbolStrtab, sym.ElfSym().Name))
+				// 定义所在的段没有输出，符号无处可放，引用它的重定位也就无法保留
+				if idx == 0 {
+					ctx.Diag.Error(fmt.Errorf("%s: symbol %s is defined in discarded section %s",
+						def.File, sym.Name, def.sectionName(sym.ElfSym(), sym.SymIdx)))
+				}
+			}
+			if idx == 0 {
+				continue
+			}
+
+			out := &s.Entries[idx-1]
+			out.Other = out.Other&^3 | uint8(sym.Visibility)
+			seen[sym] = idx
+			file.OutputSymIndices[i] = idx
+		}
+	}
+
+	s.Shdr.Size = uint64(len(s.Entries)+1) * uint64(SymSize)
+}
+
+func (s *SymtabSection) UpdateShdr(ctx *Context) {
+	s.Shdr.Link = uint32(ctx.Strtab.Shndx)
+}
+
+func (s *SymtabSection) CopyBuf(ctx *Context) {
+	base := ctx.Buf[s.Shdr.Offset:]
+	utils.Write[Sym](base, Sym{})
+
+	if ctx.Args.Relocatable {
+		utils.Write[[]Sym](base[SymSize:], s.Entries)
+		return
+	}
+
+	for i, sym := range s.Symbols {
+		elfSym := sym.ElfSym()
+		esym := Sym{
+			Name:  ctx.Strtab.Offsets[sym.Name],
+			Info:  elfSym.Info,
+			Other: elfSym.Other,
+			Size:  elfSym.Size,
+		}
+
+		if elf.ST_BIND(elfSym.Info) != elf.STB_LOCAL {
+			esym.Other = uint8(sym.Visibility)
+		}
+		if i+1 < int(s.Shdr.Info) {
+			esym.Info = uint8(elf.STB_LOCAL)<<4 | elfSym.Type()
+		}
+
+		if !sym.File.IsDso && !elfSym.IsUndef() {
+			esym.Shndx = uint16(sym.GetOutputShndx(ctx))
+			esym.Val = sym.GetDefinedAddr(ctx)
+
+			// 可执行文件和动态库中TLS符号的值是它在TLS段中的偏移
+			if elfSym.Type() == uint8(elf.STT_TLS) {
+				esym.Val -= ctx.TpAddr
+			}
+		}
+
+		utils.Write[Sym](base[(i+1)*SymSize:], esym)
+	}
+}
@@ -0,0 +1,31 @@
+package linker
+
+import (
+	"debug/elf"
+	"rvld/pkg/utils"
+)
+
+// 段的下标超过SHN_LORESERVE时，.symtab中的st_shndx为SHN_XINDEX，真正的下标存放在这里
+type SymtabShndxSection struct {
+	Chunk
+}
+
+func NewSymtabShndxSection() *SymtabShndxSection {
+	s := &SymtabShndxSection{Chunk: NewChunk()}
+	s.Name = ".symtab_shndx"
+	s.Shdr.Type = uint32(elf.SHT_SYMTAB_SHNDX)
+	s.Shdr.EntSize = 4
+	s.Shdr.AddrAlign = 4
+	return s
+}
+
+func (s *SymtabShndxSection) UpdateShdr(ctx *Context) {
+	s.Shdr.Size = uint64(len(ctx.Symtab.Xindices)+1) * 4
+	s.Shdr.Link = uint32(ctx.Symtab.Shndx)
+}
+
+func (s *SymtabShndxSection) CopyBuf(ctx *Context) {
+	base := ctx.Buf[s.Shdr.Offset:]
+	utils.Write[uint32](base, 0)
+	utils.Write[[]uint32](base[4:], ctx.Symtab.Xindices)
+}
@@ -0,0 +1,72 @@
+package linker
+
+import (
+	"debug/elf"
+	"path/filepath"
+	"rvld/pkg/utils"
+)
+
+type VerdefSection struct {
+	Chunk
+	Contents []byte
+}
+
+func NewVerdefSection() *VerdefSection {
+	v := &VerdefSection{Chunk: NewChunk()}
+	v.Name = ".gnu.version_d"
+	v.Shdr.Type = uint32(elf.SHT_GNU_VERDEF)
+	v.Shdr.Flags = uint64(elf.SHF_ALLOC)
+	v.Shdr.AddrAlign = 8
+	return v
+}
+
+// 第一项是输出文件自身的基础版本，之后依次是版本脚本中定义的各个版本
+func (v *VerdefSection) Construct(ctx *Context) {
+	basename := ctx.Args.Soname
+	if basename == "" {
+		basename = filepath.Base(ctx.Args.Output)
+	}
+
+	defs := []VersionDefinition{{Name: basename}}
+	defs = append(defs, ctx.Args.VersionDefinitions...)
+
+	v.Contents = make([]byte, 0)
+	for i, def := range defs {
+		names := append([]string{def.Name}, def.Parents...)
+		verdef := Verdef{
+			Version: 1,
+			Ndx:     uint16(i) + VER_NDX_GLOBAL,
+			Cnt:     uint16(len(names)),
+			Hash:    elfHash(def.Name),
+			Aux:     uint32(VerdefSize),
+		}
+		if i == 0 {
+			verdef.Flags = VER_FLG_BASE
+		}
+		if i != len(defs)-1 {
+			verdef.Next = uint32(VerdefSize + len(names)*VerdauxSize)
+		}
+
+		buf := make([]byte, VerdefSize+len(names)*VerdauxSize)
+		utils.Write[Verdef](buf, verdef)
+		for j, name := range names {
+			verdaux := Verdaux{Name: ctx.Dynstr.AddString(name)}
+			if j != len(names)-1 {
+				verdaux.Next = uint32(VerdauxSize)
+			}
+			utils.Write[Verdaux](buf[VerdefSize+j*VerdauxSize:], verdaux)
+		}
+		v.Contents = append(v.Contents, buf...)
+	}
+
+	v.Shdr.Size = uint64(len(v.Contents))
+	v.Shdr.Info = uint32(len(defs))
+}
+
+func (v *VerdefSection) UpdateShdr(ctx *Context) {
+	v.Shdr.Link = uint32(ctx.Dynstr.Shndx)
+}
+
+func (v *VerdefSection) CopyBuf(ctx *Context) {
+	copy(ctx.Buf[v.Shdr.Offset:], v.Contents)
+}
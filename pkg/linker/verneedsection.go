@@ -0,0 +1,109 @@
+package linker
+
+import (
+	"debug/elf"
+	"rvld/pkg/utils"
+	"slices"
+)
+
+type VerneedSection struct {
+	Chunk
+	Contents []byte
+}
+
+func NewVerneedSection() *VerneedSection {
+	v := &VerneedSection{Chunk: NewChunk()}
+	v.Name = ".gnu.version_r"
+	v.Shdr.Type = uint32(elf.SHT_GNU_VERNEED)
+	v.Shdr.Flags = uint64(elf.SHF_ALLOC)
+	v.Shdr.AddrAlign = 8
+	return v
+}
+
+// 记录引用到的动态库中的符号版本，每个动态库一个Verneed，每个版本一个Vernaux
+func (v *VerneedSection) Construct(ctx *Context) {
+	versions := make(map[*SharedFile][]string)
+	for _, sym := range ctx.Dynsym.Symbols {
+		if !sym.File.IsDso {
+			continue
+		}
+
+		file := findSharedFile(ctx, sym.File)
+		if ver := file.GetVersion(sym); ver != "" && !slices.Contains(versions[file], ver) {
+			versions[file] = append(versions[file], ver)
+		}
+	}
+
+	// 版本下标接在.gnu.version_d中定义的版本之后
+	nextIdx := VER_NDX_GLOBAL + 1 + uint16(len(ctx.Args.VersionDefinitions))
+	type key struct {
+		file *SharedFile
+		ver  string
+	}
+	indices := make(map[key]uint16)
+
+	v.Contents = make([]byte, 0)
+	lastOffset := -1
+	numFiles := 0
+	for _, file := range ctx.Dsos {
+		vers := versions[file]
+		if len(vers) == 0 {
+			continue
+		}
+
+		buf := make([]byte, VerneedSize+len(vers)*VernauxSize)
+		utils.Write[Verneed](buf, Verneed{
+			Version: 1,
+			Cnt:     uint16(len(vers)),
+			File:    ctx.Dynstr.AddString(file.Soname),
+			Aux:     uint32(VerneedSize),
+			Next:    uint32(len(buf)),
+		})
+
+		for i, ver := range vers {
+			vernaux := Vernaux{
+				Hash:  elfHash(ver),
+				Other: nextIdx,
+				Name:  ctx.Dynstr.AddString(ver),
+			}
+			if i != len(vers)-1 {
+				vernaux.Next = uint32(VernauxSize)
+			}
+			utils.Write[Vernaux](buf[VerneedSize+i*VernauxSize:], vernaux)
+
+			indices[key{file, ver}] = nextIdx
+			nextIdx++
+		}
+
+		lastOffset = len(v.Contents)
+		numFiles++
+		v.Contents = append(v.Contents, buf...)
+	}
+
+	// 最后一个Verneed的Next为0
+	if lastOffset != -1 {
+		verneed := utils.Read[Verneed](v.Contents[lastOffset:])
+		verneed.Next = 0
+		utils.Write[Verneed](v.Contents[lastOffset:], verneed)
+	}
+
+	for _, sym := range ctx.Dynsym.Symbols {
+		if sym.File.IsDso {
+			file := findSharedFile(ctx, sym.File)
+			if ver := file.GetVersion(sym); ver != "" {
+				sym.VerIdx = indices[key{file, ver}]
+			}
+		}
+	}
+
+	v.Shdr.Size = uint64(len(v.Contents))
+	v.Shdr.Info = uint32(numFiles)
+}
+
+func (v *VerneedSection) UpdateShdr(ctx *Context) {
+	v.Shdr.Link = uint32(ctx.Dynstr.Shndx)
+}
+
+func (v *VerneedSection) CopyBuf(ctx *Context) {
+	copy(ctx.Buf[v.Shdr.Offset:], v.Contents)
+}
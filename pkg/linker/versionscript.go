@@ -0,0 +1,173 @@
+package linker
+
+import (
+	"fmt"
+	"path"
+	"rvld/pkg/utils"
+	"strings"
+)
+
+type VersionDefinition struct {
+	Name    string
+	Parents []string
+}
+
+type VersionPattern struct {
+	Pattern string
+	VerIdx  uint16
+}
+
+// 版本脚本的格式如下，匿名的版本节点只能单独出现
+//
+//	VER_1 { global: foo; bar*; local: *; };
+//	VER_2 { global: baz; } VER_1;
+func ParseVersionScript(ctx *Context, filename string) {
+	file := MustNewFile(ctx, filename)
+	tokens := tokenizeScript(string(file.Contents))
+
+	if len(tokens) > 0 && tokens[0] == "{" {
+		tokens = readVersionNode(ctx, file, tokens, VER_NDX_GLOBAL)
+		tokens = expectToken(file, tokens, ";")
+		if len(tokens) > 0 {
+			utils.Fatal(fmt.Sprintf("%s: anonymous version definition is used in "+
+				"combination with other version definitions", file.Name))
+		}
+		return
+	}
+
+	for len(tokens) > 0 {
+		def := VersionDefinition{Name: tokens[0]}
+		for _, d := range ctx.Args.VersionDefinitions {
+			if d.Name == def.Name {
+				utils.Fatal(fmt.Sprintf("%s: duplicate version: %s", file.Name, def.Name))
+			}
+		}
+
+		// 版本下标从2开始，0和1分别表示本地符号和全局符号
+		idx := uint16(len(ctx.Args.VersionDefinitions)) + VER_NDX_GLOBAL + 1
+		tokens = readVersionNode(ctx, file, tokens[1:], idx)
+
+		for len(tokens) > 0 && tokens[0] != ";" {
+			if getVersionIndex(ctx, tokens[0]) == VER_NDX_LOCAL {
+				utils.Fatal(fmt.Sprintf("%s: unknown parent version: %s", file.Name, tokens[0]))
+			}
+			def.Parents = append(def.Parents, tokens[0])
+			tokens = tokens[1:]
+		}
+
+		tokens = expectToken(file, tokens, ";")
+		ctx.Args.VersionDefinitions = append(ctx.Args.VersionDefinitions, def)
+	}
+}
+
+func readVersionNode(ctx *Context, file *File, tokens []string, verIdx uint16) []string {
+	tokens = expectToken(file, tokens, "{")
+
+	isGlobal := true
+	for len(tokens) > 0 && tokens[0] != "}" {
+		if len(tokens) > 1 && tokens[1] == ":" {
+			switch tokens[0] {
+			case "global":
+				isGlobal = true
+			case "local":
+				isGlobal = false
+			default:
+				utils.Fatal(fmt.Sprintf("%s: unknown label: %s", file.Name, tokens[0]))
+			}
+			tokens = tokens[2:]
+			continue
+		}
+
+		if tokens[0] == "extern" {
+			if len(tokens) < 2 || (tokens[1] != "C" && tokens[1] != "C++") {
+				utils.Fatal(fmt.Sprintf("%s: unsupported extern language in version script",
+					file.Name))
+			}
+
+			isCxx := tokens[1] == "C++"
+			tokens = expectToken(file, tokens[2:], "{")
+			if isCxx {
+				// C++的模式要和demangle之后的符号名匹配，这里没有实现demangle，整块忽略。
+				// 模式中的::会被拆成多个记号，所以直接跳到块的末尾
+				ctx.Diag.Warn(fmt.Sprintf("%s: extern \"C++\" is not supported, "+
+					"ignoring its patterns", file.Name))
+				for len(tokens) > 0 && tokens[0] != "}" {
+					tokens = tokens[1:]
+				}
+			}
+
+			for len(tokens) > 0 && tokens[0] != "}" {
+				addVersionPattern(ctx, tokens[0], isGlobal, verIdx)
+				tokens = expectToken(file, tokens[1:], ";")
+			}
+			tokens = expectToken(file, tokens, "}")
+			tokens = expectToken(file, tokens, ";")
+			continue
+		}
+
+		addVersionPattern(ctx, tokens[0], isGlobal, verIdx)
+		tokens = expectToken(file, tokens[1:], ";")
+	}
+
+	return expectToken(file, tokens, "}")
+}
+
+func addVersionPattern(ctx *Context, pattern string, isGlobal bool, verIdx uint16) {
+	if !isGlobal {
+		verIdx = VER_NDX_LOCAL
+	}
+	// fnmatch用[!...]表示取反，path.Match用的是[^...]
+	pattern = strings.ReplaceAll(pattern, "[!", "[^")
+	ctx.Args.VersionPatterns = append(ctx.Args.VersionPatterns,
+		VersionPattern{Pattern: pattern, VerIdx: verIdx})
+}
+
+func expectToken(file *File, tokens []string, tok string) []string {
+	if len(tokens) == 0 || tokens[0] != tok {
+		utils.Fatal(fmt.Sprintf("%s: expected %s", file.Name, tok))
+	}
+	return tokens[1:]
+}
+
+func getVersionIndex(ctx *Context, name string) uint16 {
+	for i, def := range ctx.Args.VersionDefinitions {
+		if def.Name == name {
+			return uint16(i) + VER_NDX_GLOBAL + 1
+		}
+	}
+	return VER_NDX_LOCAL
+}
+
+func isGlobPattern(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// 和lld一样，精确匹配的优先级最高，其次是其他通配符，单独的*优先级最低
+func matchVersionPatterns(ctx *Context, name string) uint16 {
+	for _, p := range ctx.Args.VersionPatterns {
+		if !isGlobPattern(p.Pattern) && p.Pattern == name {
+			return p.VerIdx
+		}
+	}
+
+	wildcard := -1
+	for i, p := range ctx.Args.VersionPatterns {
+		if p.Pattern == "*" {
+			if wildcard < 0 {
+				wildcard = i
+			}
+			continue
+		}
+
+		if isGlobPattern(p.Pattern) {
+			if ok, _ := path.Match(p.Pattern, name); ok {
+				return p.VerIdx
+			}
+		}
+	}
+
+	if wildcard >= 0 {
+		return ctx.Args.VersionPatterns[wildcard].VerIdx
+	}
+	return VER_NDX_GLOBAL
+}
@@ -0,0 +1,38 @@
+package linker
+
+import (
+	"debug/elf"
+	"rvld/pkg/utils"
+)
+
+type VersymSection struct {
+	Chunk
+}
+
+func NewVersymSection() *VersymSection {
+	v := &VersymSection{Chunk: NewChunk()}
+	v.Name = ".gnu.version"
+	v.Shdr.Type = uint32(elf.SHT_GNU_VERSYM)
+	v.Shdr.Flags = uint64(elf.SHF_ALLOC)
+	v.Shdr.EntSize = 2
+	v.Shdr.AddrAlign = 2
+	return v
+}
+
+func (v *VersymSection) UpdateShdr(ctx *Context) {
+	// 没有任何版本信息时不需要输出这个段
+	if ctx.Verneed.Shdr.Size == 0 && (ctx.Verdef == nil || ctx.Verdef.Shdr.Size == 0) {
+		v.Shdr.Size = 0
+	} else {
+		v.Shdr.Size = uint64(len(ctx.Dynsym.Symbols)+1) * 2
+	}
+	v.Shdr.Link = uint32(ctx.Dynsym.Shndx)
+}
+
+func (v *VersymSection) CopyBuf(ctx *Context) {
+	base := ctx.Buf[v.Shdr.Offset:]
+	utils.Write[uint16](base, VER_NDX_LOCAL)
+	for _, sym := range ctx.Dynsym.Symbols {
+		utils.Write[uint16](base[sym.DynsymIdx*2:], sym.VerIdx)
+	}
+}
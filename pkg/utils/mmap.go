@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"os"
+	"sync"
+	"unsafe"
+)
+
+type mapping struct {
+	name     string
+	data     []byte
+	writable bool
+}
+
+// 记录一次链接中映射到内存的所有文件，访问被截断的文件时产生的SIGBUS可以据此找到出错的文件。
+// 零值可以直接使用
+type Mappings struct {
+	mu sync.Mutex
+	m  map[*byte]mapping
+}
+
+// 把整个文件映射到内存中，writable为false时映射为只读
+func (ms *Mappings) Mmap(f *os.File, size int, writable bool) ([]byte, error) {
+	data, err := mmap(f, size, writable)
+	if err != nil {
+		return nil, err
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.m == nil {
+		ms.m = make(map[*byte]mapping)
+	}
+	ms.m[unsafe.SliceData(data)] = mapping{f.Name(), data, writable}
+	return data, nil
+}
+
+func (ms *Mappings) Munmap(data []byte) error {
+	ms.mu.Lock()
+	delete(ms.m, unsafe.SliceData(data))
+	ms.mu.Unlock()
+	return munmap(data)
+}
+
+// 返回包含地址addr的映射对应的文件名
+func (ms *Mappings) Find(addr uintptr) (string, bool) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for base, m := range ms.m {
+		start := uintptr(unsafe.Pointer(base))
+		if start <= addr && addr < start+uintptr(len(m.data)) {
+			return m.name, true
+		}
+	}
+	return "", false
+}
+
+// 链接结束后释放所有输入文件的映射，输出文件的映射由OutputFile自己负责
+func (ms *Mappings) UnmapInputFiles() {
+	ms.mu.Lock()
+	var inputs [][]byte
+	for _, m := range ms.m {
+		if !m.writable {
+			inputs = append(inputs, m.data)
+		}
+	}
+	ms.mu.Unlock()
+
+	for _, data := range inputs {
+		ms.Munmap(data)
+	}
+}
@@ -0,0 +1,24 @@
+//go:build unix
+
+package utils
+
+import (
+	"os"
+	"syscall"
+)
+
+// 只读的映射用MAP_PRIVATE，输出文件要通过映射写回文件，所以用MAP_SHARED
+func mmap(f *os.File, size int, writable bool) ([]byte, error) {
+	prot := syscall.PROT_READ
+	flags := syscall.MAP_PRIVATE
+	if writable {
+		prot |= syscall.PROT_WRITE
+		flags = syscall.MAP_SHARED
+	}
+
+	return syscall.Mmap(int(f.Fd()), 0, size, prot, flags)
+}
+
+func munmap(data []byte) error {
+	return syscall.Munmap(data)
+}
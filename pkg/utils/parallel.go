@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"hash/maphash"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+)
+
+// 用最多threads个goroutine并行执行fn(0)到fn(n-1)，所有调用结束后才返回
+func ParallelFor(threads int, n int, fn func(i int)) {
+	if threads <= 1 || n <= 1 {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	var once sync.Once
+	var panicked bool
+	var panicVal any
+	for w := 0; w < min(threads, n); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// 和调用者一样，访问被截断的映射文件时panic而不是直接崩溃
+			debug.SetPanicOnFault(true)
+			// 把工作线程中的panic(例如utils.Fatal)转交给调用者所在的goroutine
+			defer func() {
+				if r := recover(); r != nil {
+					once.Do(func() {
+						panicked = true
+						panicVal = r
+					})
+					next.Store(int64(n))
+				}
+			}()
+
+			for {
+				i := int(next.Add(1)) - 1
+				if i >= n {
+					return
+				}
+				fn(i)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if panicked {
+		panic(panicVal)
+	}
+}
+
+const numShards = 64
+
+type shard[V any] struct {
+	mu sync.Mutex
+	m  map[string]V
+}
+
+// 按键的哈希值分片加锁的map，可以被多个goroutine同时访问
+type ShardedMap[V any] struct {
+	seed   maphash.Seed
+	shards [numShards]shard[V]
+}
+
+func NewShardedMap[V any]() *ShardedMap[V] {
+	m := &ShardedMap[V]{seed: maphash.MakeSeed()}
+	for i := range m.shards {
+		m.shards[i].m = make(map[string]V)
+	}
+	return m
+}
+
+func (m *ShardedMap[V]) getShard(key string) *shard[V] {
+	return &m.shards[maphash.String(m.seed, key)%numShards]
+}
+
+func (m *ShardedMap[V]) Get(key string) (V, bool) {
+	s := m.getShard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	val, ok := s.m[key]
+	return val, ok
+}
+
+// 键不存在时用create创建一个新的值，同一个键只会创建一次
+func (m *ShardedMap[V]) GetOrInsert(key string, create func() V) V {
+	s := m.getShard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if val, ok := s.m[key]; ok {
+		return val
+	}
+	val := create()
+	s.m[key] = val
+	return val
+}
+
+// 遍历的顺序是不确定的
+func (m *ShardedMap[V]) Range(fn func(key string, val V)) {
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.mu.Lock()
+		for key, val := range s.m {
+			fn(key, val)
+		}
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// 依次记录链接过程中每个阶段的耗时，开始新的阶段时会结束上一个阶段
+type Timer struct {
+	Names     []string
+	Durations []time.Duration
+	start     time.Time
+	total     time.Duration
+}
+
+func (t *Timer) Start(name string) {
+	t.Stop()
+	t.Names = append(t.Names, name)
+	t.start = time.Now()
+}
+
+func (t *Timer) Stop() {
+	if len(t.Names) == len(t.Durations) {
+		return
+	}
+
+	elapsed := time.Since(t.start)
+	t.Durations = append(t.Durations, elapsed)
+	t.total += elapsed
+}
+
+func (t *Timer) Print(w io.Writer) {
+	t.Stop()
+	fmt.Fprintf(w, "%12s  %6s  %s\n", "time", "%", "phase")
+	for i, name := range t.Names {
+		percent := 0.0
+		if t.total > 0 {
+			percent = float64(t.Durations[i]) * 100 / float64(t.total)
+		}
+		fmt.Fprintf(w, "%10.3fms  %5.1f%%  %s\n",
+			float64(t.Durations[i].Microseconds())/1000, percent, name)
+	}
+	fmt.Fprintf(w, "%10.3fms  %5.1f%%  total\n", float64(t.total.Microseconds())/1000, 100.0)
+}
@@ -3,17 +3,37 @@ package utils
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"math/bits"
 	"os"
+	"reflect"
 	"runtime/debug"
 	"strings"
+	"sync"
+	"unsafe"
 )
 
+// 无法继续链接时由Fatal抛出，在linker.Run中被恢复并作为错误返回
+type FatalError struct {
+	Err   error
+	Stack []byte
+}
+
+func (e *FatalError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *FatalError) Unwrap() error {
+	return e.Err
+}
+
 func Fatal(v any) {
-	fmt.Printf("rvld: \033[0;1;31mfatal:\033[0m %v\n", v)
-	debug.PrintStack()
-	os.Exit(0)
+	err, ok := v.(error)
+	if !ok {
+		err = errors.New(fmt.Sprint(v))
+	}
+	panic(&FatalError{Err: err, Stack: debug.Stack()})
 }
 
 func MustNo(err error) {
@@ -29,6 +49,11 @@ func Assert(condition bool) {
 }
 
 func Read[T any](data []byte) (val T) {
+	if size := nativeSize[T](); size > 0 && len(data) >= size {
+		copy(unsafe.Slice((*byte)(unsafe.Pointer(&val)), size), data)
+		return
+	}
+
 	reader := bytes.NewReader(data)
 	err := binary.Read(reader, binary.LittleEndian, &val)
 	MustNo(err)
@@ -37,22 +62,84 @@ func Read[T any](data []byte) (val T) {
 
 func ReadSlice[T any](data []byte, size int) []T {
 	len := len(data) / size
-	res := make([]T, 0, len)
-	for len > 0 {
-		res = append(res, Read[T](data))
-		data = data[size:]
-		len--
+	res := make([]T, len)
+
+	// 复制一份而不是直接引用data，这样修改结果不会影响到输入文件的内容
+	if nativeSize[T]() == size {
+		copy(unsafe.Slice((*byte)(unsafe.Pointer(unsafe.SliceData(res))), len*size), data)
+		return res
+	}
+
+	for i := range res {
+		res[i] = Read[T](data[i*size:])
 	}
 	return res
 }
 
 func Write[T any](data []byte, e T) {
+	if size := nativeSize[T](); size > 0 {
+		copy(data, unsafe.Slice((*byte)(unsafe.Pointer(&e)), size))
+		return
+	}
+
+	// 元素的内存布局和文件中一致的切片也可以直接复制
+	if size := nativeSliceElemSize[T](); size > 0 {
+		header := (*[]byte)(unsafe.Pointer(&e))
+		copy(data, unsafe.Slice(unsafe.SliceData(*header), len(*header)*size))
+		return
+	}
+
 	buf := &bytes.Buffer{}
 	err := binary.Write(buf, binary.LittleEndian, e)
 	MustNo(err)
 	copy(data, buf.Bytes())
 }
 
+var isLittleEndian = binary.NativeEndian.Uint16([]byte{1, 0}) == 1
+
+// 类型的内存布局和encoding/binary编码的结果完全一致时返回它的大小，否则返回0
+var nativeSizes sync.Map
+
+func nativeSize[T any]() int {
+	typ := reflect.TypeFor[T]()
+	if size, ok := nativeSizes.Load(typ); ok {
+		return size.(int)
+	}
+
+	size := sizeOfType(typ)
+	nativeSizes.Store(typ, size)
+	return size
+}
+
+var nativeSliceElemSizes sync.Map
+
+func nativeSliceElemSize[T any]() int {
+	typ := reflect.TypeFor[T]()
+	if size, ok := nativeSliceElemSizes.Load(typ); ok {
+		return size.(int)
+	}
+
+	size := 0
+	if typ.Kind() == reflect.Slice {
+		size = sizeOfType(typ.Elem())
+	}
+	nativeSliceElemSizes.Store(typ, size)
+	return size
+}
+
+// 小端序的机器上，没有填充字节的定长类型在内存中的表示就是它在文件中的表示
+func sizeOfType(typ reflect.Type) int {
+	if !isLittleEndian {
+		return 0
+	}
+
+	size := binary.Size(reflect.New(typ).Interface())
+	if size <= 0 || size != int(typ.Size()) {
+		return 0
+	}
+	return size
+}
+
 func RemovePrefix(s, prefix string) (string, bool) {
 	if strings.HasPrefix(s, prefix) {
 		s = strings.TrimPrefix(s, prefix)
@@ -117,3 +204,42 @@ func Bits[T Uint](val T, hi T, lo T) T {
 func SignExtend(val uint64, size int) uint64 {
 	return uint64(int64(val<<(63-size)) >> (63 - size))
 }
+
+func ReadUleb(buf []byte) uint64 {
+	val := uint64(0)
+	shift := 0
+	for {
+		b := buf[0]
+		buf = buf[1:]
+		val |= uint64(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			return val
+		}
+	}
+}
+
+func AppendUleb(buf []byte, val uint64) []byte {
+	for val >= 0x80 {
+		buf = append(buf, 0x80|byte(val&0x7f))
+		val >>= 7
+	}
+	return append(buf, byte(val))
+}
+
+// 保持原来的字节数不变，就地写入ULEB128编码的整数，原来的字节数放不下时返回false
+func OverwriteUleb(buf []byte, val uint64) bool {
+	for buf[0]&0x80 != 0 {
+		buf[0] = 0x80 | byte(val&0x7f)
+		buf = buf[1:]
+		val >>= 7
+	}
+	buf[0] = byte(val & 0x7f)
+	return val < 0x80
+}
+
+// 终端是字符设备，重定向到普通文件或管道时不是
+func IsTerminal(f *os.File) bool {
+	st, err := f.Stat()
+	return err == nil && st.Mode()&os.ModeCharDevice != 0
+}
@@ -1,9 +1,7 @@
 package main
 
 import (
-	"fmt"
 	"os"
-	"path/filepath"
 	"rvld/pkg/linker"
 	"rvld/pkg/utils"
 	"strings"
@@ -13,13 +11,20 @@ var version string
 
 func main() {
 	ctx := linker.NewContext()
+	if err := linker.Run(ctx, func() { link(ctx) }); err != nil {
+		os.Exit(1)
+	}
+}
+
+func link(ctx *linker.Context) {
 	remaining := parseArgs(ctx)
+	// 这里打开的文件记录在ctx.Files中，ReadInputFiles会直接复用同一个映射
 	if ctx.Args.Emulation == linker.MachineTypeNone {
 		for _, filename := range remaining {
 			if strings.HasPrefix(filename, "-") {
 				continue
 			}
-			file := linker.MustNewFile(filename)
+			file := linker.MustNewFile(ctx, filename)
 			ctx.Args.Emulation = linker.GetMachineTypeFromContents(file.Contents)
 			if ctx.Args.Emulation != linker.MachineTypeNone {
 				break
@@ -31,14 +36,42 @@ func main() {
 		utils.Fatal("unknown emulation type")
 	}
 
+	timer := &utils.Timer{}
+	timer.Start("read_input_files")
 	linker.ReadInputFiles(ctx, remaining)
+	linker.CreateInternalFile(ctx)
+
+	timer.Start("resolve_symbols")
 	linker.ResolveSymbols(ctx)
-	linker.MarkLiveObjects(ctx)
+	linker.CheckDuplicateSymbols(ctx)
+	if !ctx.Args.Shared && !ctx.Args.Relocatable {
+		linker.ReportUndefinedSymbols(ctx)
+	}
+	ctx.Diag.Checkpoint()
+
+	if ctx.Args.Relocatable {
+		linkRelocatable(ctx, timer)
+		return
+	}
+
+	timer.Start("merge_sections")
 	linker.RegisterSectionPieces(ctx)
+	linker.ComputeMergedSectionSizes(ctx)
+
+	timer.Start("create_output_sections")
 	linker.CreateSyntheticSections(ctx)
 	linker.BinSections(ctx)
 	ctx.Chunks = append(ctx.Chunks, linker.CollectOutputSections(ctx)...)
+
+	timer.Start("scan_relocations")
+	linker.ApplyVersionScript(ctx)
+	linker.ComputeImportExport(ctx)
 	linker.ScanRelocations(ctx)
+	linker.ConstructVersionSections(ctx)
+	linker.ConstructEhFrame(ctx)
+	linker.ComputeSymtab(ctx)
+
+	timer.Start("compute_layout")
 	linker.ComputeSectionSizes(ctx)
 	linker.SortOutputSections(ctx)
 
@@ -46,111 +79,50 @@ func main() {
 		chunk.UpdateShdr(ctx)
 	}
 
+	linker.ComputeSectionHeaders(ctx)
+
 	fileSize := linker.SetOutputSectionOffsets(ctx)
-	println(fileSize)
-	ctx.Buf = make([]byte, fileSize)
-	file, err := os.OpenFile(ctx.Args.Output, os.O_RDWR|os.O_CREATE, 0777)
-	utils.MustNo(err)
-	for _, chunk := range ctx.Chunks {
-		chunk.CopyBuf(ctx)
+	linker.FixSyntheticSymbols(ctx)
+
+	if ctx.Args.CompressDebugSections != 0 {
+		timer.Start("compress_debug_sections")
+		linker.CompressDebugSections(ctx)
+		fileSize = linker.SetOutputSectionOffsets(ctx)
 	}
 
-	_, err = file.Write(ctx.Buf)
-	utils.MustNo(err)
+	writeOutput(ctx, timer, fileSize)
 }
 
-func parseArgs(ctx *linker.Context) []string {
-	args := os.Args[1:]
-
-	dashes := func(name string) []string {
-		if len(name) == 1 {
-			return []string{"-" + name}
-		}
-		return []string{"-" + name, "--" + name}
-	}
+func linkRelocatable(ctx *linker.Context, timer *utils.Timer) {
+	timer.Start("create_output_sections")
+	linker.BinSections(ctx)
+	linker.FixRelocatableOutputSections(ctx)
 
-	readFlag := func(name string) bool {
-		for _, opt := range dashes(name) {
-			if args[0] == opt {
-				args = args[1:]
-				return true
-			}
-		}
-		return false
-	}
+	timer.Start("compute_layout")
+	linker.ComputeSectionSizes(ctx)
+	linker.CreateRelocatableSections(ctx)
+	fileSize := linker.SetRelocatableOffsets(ctx)
 
-	arg := ""
-	readArg := func(name string) bool {
-		for _, opt := range dashes(name) {
-			if args[0] == opt {
-				if len(args) == 1 {
-					utils.Fatal(fmt.Sprintf("option -%s: argument missing", name))
-				}
-
-				arg = args[1]
-				args = args[2:]
-				return true
-			}
+	writeOutput(ctx, timer, fileSize)
+}
 
-			prefix := opt
-			if len(name) > 1 {
-				prefix += "="
-			}
-			if strings.HasPrefix(args[0], prefix) {
-				arg = args[0][len(prefix):]
-				args = args[1:]
-				return true
-			}
-		}
+func writeOutput(ctx *linker.Context, timer *utils.Timer, fileSize uint64) {
+	timer.Start("copy_buf")
+	output := linker.OpenOutputFile(ctx, fileSize)
+	ctx.Buf = output.Buf
+	// 每个Chunk只写入ctx.Buf中属于自己的区域，可以并行执行
+	linker.CopyChunks(ctx)
 
-		return false
-	}
+	// 重定位溢出等错误不会留下输出文件
+	ctx.Diag.Checkpoint()
 
-	remaining := make([]string, 0)
-	for len(args) > 0 {
-		if readFlag("help") {
-			fmt.Printf("usage: %s [options] file...\n", os.Args[0])
-			os.Exit(0)
-		}
-		if readArg("o") || readArg("output") {
-			ctx.Args.Output = arg
-		} else if readFlag("v") || readFlag("version") {
-			fmt.Printf("rvld %s\n", version)
-			os.Exit(0)
-		} else if readArg("m") {
-			if arg == "elf64lriscv" {
-				ctx.Args.Emulation = linker.MachineTypeRISCV64
-			} else {
-				utils.Fatal(fmt.Sprintf("unknown -m argument: %s", arg))
-			}
-		} else if readArg("L") {
-			ctx.Args.LibraryPaths = append(ctx.Args.LibraryPaths, arg)
-		} else if readArg("l") {
-			remaining = append(remaining, "-l"+arg)
-		} else if readArg("sysroot") ||
-			readFlag("static") ||
-			readArg("plugin") ||
-			readArg("plugin-opt") ||
-			readFlag("as-needed") ||
-			readFlag("start-group") ||
-			readFlag("end-group") ||
-			readArg("hash-style") ||
-			readArg("build-id") ||
-			readFlag("s") ||
-			readFlag("no-relax") {
-			// Ignored
-		} else {
-			if args[0][0] == '-' {
-				utils.Fatal(fmt.Sprintf("unknown command line option: %s", args[0]))
-			}
-			remaining = append(remaining, args[0])
-			args = args[1:]
-		}
-	}
+	timer.Start("write_output")
+	output.Close()
+	linker.PrintMap(ctx)
+	linker.PrintCref(ctx)
+	linker.PrintWhyExtract(ctx)
 
-	for i, path := range ctx.Args.LibraryPaths {
-		ctx.Args.LibraryPaths[i] = filepath.Clean(path)
+	if ctx.Args.Perf {
+		timer.Print(os.Stderr)
 	}
-
-	return remaining
 }
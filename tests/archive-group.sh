@@ -0,0 +1,62 @@
+#!/bin/bash
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+mkdir -p "$t"
+
+cat <<EOF | $CC -o "$t"/a.o -c -xassembler -
+.globl _start
+_start:
+  call foo
+  ret
+EOF
+
+cat <<EOF | $CC -o "$t"/foo.o -c -xassembler -
+.globl foo
+foo:
+  call bar
+  ret
+EOF
+
+cat <<EOF | $CC -o "$t"/bar.o -c -xassembler -
+.globl bar
+bar:
+  ret
+EOF
+
+rm -f "$t"/libfoo.a "$t"/libbar.a
+ar rcs "$t"/libfoo.a "$t"/foo.o
+ar rcs "$t"/libbar.a "$t"/bar.o
+
+# 归档文件只能解析出现在它之前的文件中的引用，--warn-backrefs报告向后的引用
+./ld -static "$t"/a.o "$t"/libfoo.a "$t"/libbar.a -o "$t"/out --warn-backrefs \
+  > "$t"/log 2>&1
+! grep -q 'backward reference' "$t"/log || false
+
+./ld -static "$t"/libfoo.a "$t"/a.o -o "$t"/out --warn-backrefs > "$t"/log 2>&1 || true
+grep -q 'backward reference detected: foo in .*a.o refers to .*libfoo.a(foo.o)' "$t"/log
+
+./ld -static "$t"/a.o "$t"/libbar.a "$t"/libfoo.a -o "$t"/out --warn-backrefs \
+  > "$t"/log 2>&1 || true
+grep -q 'backward reference detected: bar in .*libfoo.a(foo.o) refers to .*libbar.a(bar.o)' "$t"/log
+
+# 同一个组中的归档文件可以互相引用
+./ld -static "$t"/a.o --start-group "$t"/libbar.a "$t"/libfoo.a --end-group \
+  -o "$t"/out --warn-backrefs > "$t"/log 2>&1
+! grep -q 'backward reference' "$t"/log || false
+
+./ld -static "$t"/a.o -\( "$t"/libbar.a "$t"/libfoo.a -\) -o "$t"/out --warn-backrefs \
+  > "$t"/log 2>&1
+! grep -q 'backward reference' "$t"/log || false
+
+# 组必须成对出现，并且不能嵌套
+./ld -static "$t"/a.o --start-group "$t"/libfoo.a -o "$t"/out > "$t"/log 2>&1 || true
+grep -q 'missing --end-group' "$t"/log
+
+./ld -static "$t"/a.o --end-group -o "$t"/out > "$t"/log 2>&1 || true
+grep -q -- '--end-group without --start-group' "$t"/log
+
+./ld -static --start-group "$t"/a.o --start-group "$t"/libfoo.a --end-group \
+  --end-group -o "$t"/out > "$t"/log 2>&1 || true
+grep -q 'nested --start-group is not allowed' "$t"/log
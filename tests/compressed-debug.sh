@@ -0,0 +1,50 @@
+#!/bin/bash
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+mkdir -p "$t"
+
+cat <<EOF | $CC -o "$t"/a.o -c -xassembler -
+.globl _start
+_start:
+  ret
+
+.section .debug_str,"MS",@progbits,1
+  .string "hello debug"
+.section .debug_info,"",@progbits
+  .quad _start
+  .fill 4096, 1, 0x5a
+EOF
+
+# 压缩后的段带有SHF_COMPRESSED标志，解压后内容不变
+for type in zlib zstd; do
+  $CC -B. -nostdlib -static "$t"/a.o -o "$t"/out-$type \
+    -Wl,--compress-debug-sections=$type
+  readelf -SW "$t"/out-$type | grep -Eq ' \.debug_info .* C '
+  readelf -SW "$t"/out-$type | grep -Eq ' \.debug_str .* C '
+  readelf -zp .debug_str "$t"/out-$type | grep -q 'hello debug'
+  readelf -zx .debug_info "$t"/out-$type | grep -q '5a5a5a5a 5a5a5a5a 5a5a5a5a 5a5a5a5a'
+done
+
+readelf -tW "$t"/out-zlib | grep -q 'ZLIB'
+readelf -tW "$t"/out-zstd | grep -q 'ZSTD'
+
+# 默认不压缩
+$CC -B. -nostdlib -static "$t"/a.o -o "$t"/out
+! readelf -SW "$t"/out | grep -Eq ' \.debug_info .* C ' || false
+
+# 输入中压缩过的调试段先解压再合并
+cat <<EOF | $CC -o "$t"/b.o -c -xassembler -Wa,--compress-debug-sections=zlib -
+.section .debug_info,"",@progbits
+  .fill 4096, 1, 0x6b
+EOF
+
+readelf -SW "$t"/b.o | grep -Eq ' \.debug_info .* C '
+$CC -B. -nostdlib -static "$t"/a.o "$t"/b.o -o "$t"/out2
+! readelf -SW "$t"/out2 | grep -Eq ' \.debug_info .* C ' || false
+readelf -x .debug_info "$t"/out2 | grep -q '5a5a5a5a 6b6b6b6b 6b6b6b6b'
+
+$CC -B. -nostdlib -static "$t"/a.o "$t"/b.o -o "$t"/out3 \
+  -Wl,--compress-debug-sections=zstd
+readelf -zx .debug_info "$t"/out3 | grep -q '5a5a5a5a 6b6b6b6b 6b6b6b6b'
@@ -0,0 +1,83 @@
+#!/bin/bash
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+mkdir -p "$t"
+
+# 动态库用linux-gnu工具链自己的链接器生成，没有这个工具链时跳过
+CC=${LINUX_CC:-riscv64-linux-gnu-gcc}
+if ! command -v "$CC" > /dev/null; then
+  echo "skipped: $CC not found"
+  exit 0
+fi
+
+cat <<EOF | $CC -o "$t"/foo.o -c -xassembler -fPIC -
+.data
+.globl foo, foo_alias
+.type foo, @object
+.type foo_alias, @object
+.size foo, 8
+.size foo_alias, 8
+.p2align 3
+foo:
+foo_alias:
+  .quad 42
+
+.section .rodata
+.globl bar
+.type bar, @object
+.size bar, 4
+bar:
+  .word 3
+EOF
+
+$CC -nostdlib -shared "$t"/foo.o -o "$t"/libfoo.so -Wl,-soname,libfoo.so
+
+# 非PIC代码用绝对地址访问动态库中的变量需要复制重定位
+cat <<EOF | $CC -o "$t"/a.o -c -xassembler -
+.globl _start
+_start:
+  lui a0, %hi(foo)
+  ld a0, %lo(foo)(a0)
+  lui a1, %hi(bar)
+  lw a1, %lo(bar)(a1)
+  ret
+EOF
+
+$CC -B. -nostdlib -no-pie "$t"/a.o "$t"/libfoo.so -o "$t"/out
+readelf -rW "$t"/out | grep -q 'R_RISCV_COPY.* foo'
+readelf -rW "$t"/out | grep -q 'R_RISCV_COPY.* bar'
+[ "$(readelf -rW "$t"/out | grep -c R_RISCV_COPY)" -eq 2 ]
+
+# 只读的变量复制到单独的段中
+readelf -SW "$t"/out | grep -q ' \.copyrel .* NOBITS .* WA '
+readelf -SW "$t"/out | grep -q ' \.copyrel\.rel\.ro .* NOBITS .* WA '
+
+# 只读变量的副本在PT_GNU_RELRO中，重定位之后会被设成只读
+set -- $(readelf -lW "$t"/out | awk '$1 == "GNU_RELRO" { print $3, $6 }')
+relro_start=$(($1))
+relro_end=$(($1 + $2))
+[ $((relro_end % 4096)) -eq 0 ]
+
+section_addr() {
+  readelf -SW "$t"/out | sed 's/^ *\[ *[0-9]*\]//' | awk -v name="$1" '$1 == name { print $3 }'
+}
+ro=$((0x$(section_addr .copyrel.rel.ro)))
+rw=$((0x$(section_addr .copyrel)))
+[ $ro -ge $relro_start ] && [ $ro -lt $relro_end ]
+[ $rw -ge $relro_end ]
+
+$CC -B. -nostdlib -no-pie "$t"/a.o "$t"/libfoo.so -o "$t"/out2 -Wl,-z,norelro
+! readelf -lW "$t"/out2 | grep -q GNU_RELRO || false
+
+# 地址相同的别名也要指向复制出来的数据
+readelf -W --dyn-syms "$t"/out > "$t"/log
+addr=$(grep ' foo$' "$t"/log | awk '{ print $2 }')
+grep ' foo_alias$' "$t"/log | grep -q " $addr "
+! grep -q 'UND foo' "$t"/log || false
+
+# -z nocopyreloc时报错
+$CC -B. -nostdlib -no-pie "$t"/a.o "$t"/libfoo.so -o "$t"/out2 -Wl,-z,nocopyreloc \
+  > "$t"/log 2>&1 || true
+grep -q "against \`foo' requires a copy relocation but -z nocopyreloc is given" "$t"/log
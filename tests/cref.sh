@@ -0,0 +1,62 @@
+#!/bin/bash
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+mkdir -p "$t"
+
+cat <<EOF | $CC -o "$t"/a.o -c -xassembler -
+.globl _start
+_start:
+  call foo
+  ret
+EOF
+
+cat <<EOF | $CC -o "$t"/b.o -c -xassembler -
+.globl bar
+bar:
+  call foo
+  ret
+EOF
+
+cat <<EOF | $CC -o "$t"/foo.o -c -xassembler -
+.globl foo
+foo:
+  ret
+EOF
+
+cat <<EOF | $CC -o "$t"/baz.o -c -xassembler -
+.globl baz
+baz:
+  ret
+EOF
+
+rm -f "$t"/libfoo.a
+ar rcs "$t"/libfoo.a "$t"/foo.o "$t"/baz.o
+
+./ld -static "$t"/a.o "$t"/b.o "$t"/libfoo.a -o "$t"/out -Map "$t"/map --cref \
+  -y foo -y baz --why-extract="$t"/why > "$t"/log
+
+# --cref输出在链接映射的末尾，定义所在的文件排在最前面
+grep -q '^Cross Reference Table$' "$t"/map
+grep -q "^foo  *$t/libfoo.a(foo.o)$" "$t"/map
+grep -A2 '^foo ' "$t"/map | grep -q "^  *$t/a.o$"
+grep -A2 '^foo ' "$t"/map | grep -q "^  *$t/b.o$"
+
+# 没有Map文件时打印到标准输出
+./ld -static "$t"/a.o "$t"/b.o "$t"/libfoo.a -o "$t"/out --cref | \
+  grep -q '^Cross Reference Table$'
+
+# -y打印符号的定义和引用，没有被拉进来的归档成员中的是lazy definition
+grep -q "^$t/a.o: reference to foo$" "$t"/log
+grep -q "^$t/b.o: reference to foo$" "$t"/log
+grep -q "^$t/libfoo.a(foo.o): definition of foo$" "$t"/log
+grep -q "^$t/libfoo.a(baz.o): lazy definition of baz$" "$t"/log
+
+# --why-extract记录每个归档成员是因为谁引用了哪个符号而被拉进来的
+head -1 "$t"/why | grep -q $'^reference\textracted\tsymbol$'
+grep -q $'^'"$t"$'/a.o\t'"$t"$'/libfoo.a(foo.o)\tfoo$' "$t"/why
+[ "$(wc -l < "$t"/why)" -eq 2 ]
+
+./ld -static "$t"/a.o "$t"/libfoo.a -o "$t"/out --why-extract=- | \
+  grep -q $'libfoo.a(foo.o)\tfoo$'
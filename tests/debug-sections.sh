@@ -0,0 +1,55 @@
+#!/bin/bash
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+mkdir -p "$t"
+
+# 输入的.eh_frame会被丢弃后重新生成，调试信息中引用它的地方要填入墓碑值
+cat <<EOF | $CC -o "$t"/a.o -c -xassembler -
+.globl _start
+_start:
+  .cfi_startproc
+  ret
+  .cfi_endproc
+
+.section .debug_info,"",@progbits
+  .quad _start
+  .quad .eh_frame
+
+.section .debug_ranges,"",@progbits
+  .quad .eh_frame
+EOF
+
+$CC -B. -nostdlib -static "$t"/a.o -o "$t"/out
+
+addr=$(readelf -sW "$t"/out | grep ' _start$' | awk '{print $2}')
+le=$(echo $addr | sed -E 's/(..)(..)(..)(..)(..)(..)(..)(..)/\8\7\6\5 \4\3\2\1/')
+
+# 一般的调试段用-1，.debug_ranges和.debug_loc用-2，因为-1在其中有特殊含义
+readelf -x .debug_info "$t"/out | grep -q "$le ffffffff ffffffff"
+readelf -x .debug_ranges "$t"/out | grep -q 'feffffff ffffffff'
+
+# 汇编器只在.uleb128 a - b跨越可以松弛的代码时才生成R_RISCV_SET_ULEB128，
+# 这里先生成R_RISCV_SET8，再把重定位类型改成R_RISCV_SET_ULEB128(60)
+cat <<EOF | $CC -o "$t"/b.o -c -xassembler -
+.globl _start
+_start:
+  ret
+
+.section .debug_info,"",@progbits
+.reloc ., R_RISCV_SET8, 200
+.byte 0
+.reloc ., R_RISCV_SET8, 100
+.byte 0
+EOF
+
+off=$(readelf -SW "$t"/b.o | sed 's/^ *\[ *[0-9]*\]//' | awk '$1 == ".rela.debug_info" { print $4 }')
+printf '\x3c' | dd of="$t"/b.o bs=1 seek=$((0x$off + 8)) conv=notrunc 2> /dev/null
+printf '\x3c' | dd of="$t"/b.o bs=1 seek=$((0x$off + 32)) conv=notrunc 2> /dev/null
+[ "$(readelf -rW "$t"/b.o | grep -c 'R_RISCV_SET_ULEB128\|unrecognized: 3c')" -eq 2 ]
+
+# 只有一个字节的ULEB128字段放不下200
+./ld -static "$t"/b.o -o "$t"/out2 2> "$t"/log || true
+grep -q '.debug_info+0x0: relocation R_RISCV_SET_ULEB128 out of range' "$t"/log
+! grep -q '+0x1:' "$t"/log || false
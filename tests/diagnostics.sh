@@ -0,0 +1,109 @@
+#!/bin/bash
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+mkdir -p "$t"
+
+cat <<EOF | $CC -o "$t"/a.o -c -xassembler -
+.globl _start, dup
+_start:
+  call foo
+  call bar
+  ret
+dup:
+  ret
+EOF
+
+cat <<EOF | $CC -o "$t"/b.o -c -xassembler -
+.globl dup
+dup:
+  ret
+EOF
+
+# 所有的未定义符号一起报告，失败时退出码为1，并且不留下输出文件
+rm -f "$t"/out
+status=0
+./ld -static "$t"/a.o -o "$t"/out 2> "$t"/log || status=$?
+[ $status -eq 1 ]
+[ ! -e "$t"/out ]
+grep -q 'undefined symbol: foo' "$t"/log
+grep -q 'undefined symbol: bar' "$t"/log
+grep -q '>>> referenced by .*a.o' "$t"/log
+
+# --error-limit之后停止报告
+status=0
+./ld -static "$t"/a.o -o "$t"/out --error-limit=1 2> "$t"/log || status=$?
+[ $status -eq 1 ]
+[ "$(grep -c 'undefined symbol' "$t"/log)" -eq 1 ]
+grep -q 'too many errors emitted' "$t"/log
+
+# 重复定义
+cat <<EOF | $CC -o "$t"/c.o -c -xassembler -
+.globl foo, bar
+foo:
+  ret
+bar:
+  ret
+EOF
+
+status=0
+./ld -static "$t"/a.o "$t"/b.o "$t"/c.o -o "$t"/out 2> "$t"/log || status=$?
+[ $status -eq 1 ]
+grep -q 'duplicate symbol: dup' "$t"/log
+
+# 输出不是终端时不带颜色，--color-diagnostics或者--color-diagnostics=always时带颜色
+! grep -q $'\e\[' "$t"/log || false
+./ld -static "$t"/a.o "$t"/b.o "$t"/c.o -o "$t"/out --color-diagnostics=always \
+  2> "$t"/log || true
+grep -q $'\e\[' "$t"/log
+
+./ld -static "$t"/a.o "$t"/b.o "$t"/c.o -o "$t"/out --color-diagnostics \
+  2> "$t"/log || true
+grep -q $'\e\[' "$t"/log
+
+./ld -static "$t"/a.o "$t"/b.o "$t"/c.o -o "$t"/out --color-diagnostics=never \
+  2> "$t"/log || true
+grep -q '^rvld: error: duplicate symbol: dup$' "$t"/log
+
+./ld -static "$t"/a.o "$t"/b.o "$t"/c.o -o "$t"/out --color-diagnostics \
+  --no-color-diagnostics 2> "$t"/log || true
+grep -q '^rvld: error: duplicate symbol: dup$' "$t"/log
+
+# 警告不影响退出码
+rm -f "$t"/libc.a "$t"/out
+ar rcs "$t"/libc.a "$t"/c.o
+./ld -static "$t"/libc.a "$t"/a.o "$t"/libc.a -o "$t"/out --warn-backrefs 2> "$t"/log
+grep -q 'warning: backward reference detected: foo' "$t"/log
+[ -e "$t"/out ]
+
+# 强定义总是优先于弱定义，弱定义不算重复定义
+cat <<EOF | $CC -o "$t"/weak.o -c -xassembler -
+.data
+.weak baz
+.type baz, @object
+.size baz, 8
+baz:
+  .quad 1
+EOF
+
+for i in 1 2; do
+  cat <<EOF | $CC -o "$t"/strong$i.o -c -xassembler -
+.data
+.globl baz
+.type baz, @object
+.size baz, 16
+baz:
+  .quad 2, 2
+EOF
+done
+
+./ld -static "$t"/a.o "$t"/c.o "$t"/weak.o "$t"/strong1.o -o "$t"/out
+readelf -sW "$t"/out | grep -Eq ' 16 OBJECT +GLOBAL .* baz$'
+
+status=0
+./ld -static "$t"/a.o "$t"/c.o "$t"/weak.o "$t"/strong1.o "$t"/strong2.o -o "$t"/out \
+  2> "$t"/log || status=$?
+[ $status -eq 1 ]
+[ "$(grep -c 'duplicate symbol' "$t"/log)" -eq 1 ]
+grep -q 'duplicate symbol: baz' "$t"/log
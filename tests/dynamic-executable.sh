@@ -0,0 +1,66 @@
+#!/bin/bash
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+mkdir -p "$t"
+
+# 动态库用linux-gnu工具链自己的链接器生成，没有这个工具链时跳过
+CC=${LINUX_CC:-riscv64-linux-gnu-gcc}
+if ! command -v "$CC" > /dev/null; then
+  echo "skipped: $CC not found"
+  exit 0
+fi
+
+cat <<EOF | $CC -o "$t"/foo.o -c -xassembler -fPIC -
+.globl foo
+foo:
+  ret
+EOF
+
+$CC -nostdlib -shared "$t"/foo.o -o "$t"/libfoo.so -Wl,-soname,libfoo.so
+rm -f "$t"/libfoo.a
+ar rcs "$t"/libfoo.a "$t"/foo.o
+
+# 数据中引用动态库中的函数
+cat <<EOF | $CC -o "$t"/a.o -c -xassembler -
+.globl _start
+_start:
+  ret
+
+.data
+.quad foo
+EOF
+
+cat <<EOF | $CC -o "$t"/b.o -c -xassembler -
+.globl _start
+_start:
+  ret
+EOF
+
+$CC -B. -nostdlib "$t"/a.o "$t"/libfoo.so -o "$t"/out \
+  -Wl,-dynamic-linker,/lib/ld-linux-riscv64-lp64d.so.1
+readelf -lW "$t"/out | grep -q 'Requesting program interpreter: /lib/ld-linux-riscv64-lp64d.so.1'
+readelf -lW "$t"/out | grep -q ' DYNAMIC '
+readelf -dW "$t"/out | grep -q 'Shared library: \[libfoo.so\]'
+readelf -SW "$t"/out | grep -q ' \.hash '
+readelf -W --dyn-syms "$t"/out | grep -q 'UND foo$'
+readelf -rW "$t"/out | grep -q 'R_RISCV_64 .* foo + 0'
+
+# --as-needed时没有被引用的动态库不会出现在DT_NEEDED中
+$CC -B. -nostdlib "$t"/b.o -Wl,--as-needed "$t"/libfoo.so -o "$t"/out
+! readelf -dW "$t"/out | grep -q 'libfoo.so' || false
+
+$CC -B. -nostdlib "$t"/b.o -Wl,--as-needed -Wl,--no-as-needed "$t"/libfoo.so -o "$t"/out
+readelf -dW "$t"/out | grep -q 'Shared library: \[libfoo.so\]'
+
+# 和GNU ld一样，符号由命令行中先出现的文件提供
+$CC -B. -nostdlib "$t"/a.o -Wl,--as-needed "$t"/libfoo.a "$t"/libfoo.so -o "$t"/out
+! readelf -dW "$t"/out | grep -q 'libfoo.so' || false
+
+$CC -B. -nostdlib "$t"/a.o -Wl,--as-needed "$t"/libfoo.so "$t"/libfoo.a -o "$t"/out
+readelf -dW "$t"/out | grep -q 'Shared library: \[libfoo.so\]'
+
+# 静态链接的输出中没有动态链接相关的段
+$CC -B. -nostdlib -static "$t"/b.o -o "$t"/out
+! readelf -lW "$t"/out | grep -Eq 'INTERP|DYNAMIC' || false
@@ -0,0 +1,119 @@
+#!/bin/bash
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+mkdir -p "$t"
+
+cat <<EOF | $CC -o "$t"/a.o -c -xassembler -
+.globl _start
+_start:
+  .cfi_startproc
+  call foo
+  ret
+  .cfi_endproc
+
+foo:
+  .cfi_startproc
+  ret
+  .cfi_endproc
+EOF
+
+# --eh-frame-hdr生成.eh_frame_hdr，并用PT_GNU_EH_FRAME指向它
+$CC -B. -nostdlib -static "$t"/a.o -o "$t"/out -Wl,--eh-frame-hdr
+readelf -SW "$t"/out | grep -q ' \.eh_frame_hdr '
+readelf -lW "$t"/out | grep -q 'GNU_EH_FRAME'
+
+# 二分查找表中每个FDE有一项，后面的.eh_frame以零结尾
+readelf -x .eh_frame_hdr "$t"/out | grep -Eq '^  0x[0-9a-f]+ 011b033b [0-9a-f]{8} 02000000 '
+readelf -wf "$t"/out | grep -c 'FDE cie=' | grep -qx 2
+readelf -wf "$t"/out | grep -q 'ZERO terminator'
+
+# 默认不生成
+$CC -B. -nostdlib -static "$t"/a.o -o "$t"/out2
+! readelf -SW "$t"/out2 | grep -q ' \.eh_frame_hdr ' || false
+! readelf -lW "$t"/out2 | grep -q 'GNU_EH_FRAME' || false
+
+# 和crtend.o一样，__FRAME_END__指向.eh_frame末尾长度为0的终止记录
+cat <<EOF | $CC -o "$t"/b.o -c -xassembler -
+.globl __FRAME_END__
+.section .eh_frame,"a",@progbits
+.p2align 2
+__FRAME_END__:
+  .word 0
+
+.data
+.p2align 3
+  .quad __FRAME_END__
+EOF
+
+$CC -B. -nostdlib -static "$t"/a.o "$t"/b.o -o "$t"/out3
+set -- $(readelf -SW "$t"/out3 | sed 's/^ *\[ *[0-9]*\]//' | awk '$1 == ".eh_frame" { print $3, $5 }')
+readelf -sW "$t"/out3 | grep -q " $(printf '%016x' $((0x$1 + 0x$2 - 4))) .* [0-9]\+ __FRAME_END__$"
+
+# 指向其他记录的符号换算到这条记录在输出中的位置，c.o的CIE和a.o的相同，会被合并
+cat <<EOF | $CC -o "$t"/c.o -c -xassembler -
+.globl bar1, bar2
+bar1:
+  .cfi_startproc
+  ret
+  .cfi_endproc
+bar2:
+  .cfi_startproc
+  addi sp, sp, -16
+  .cfi_def_cfa_offset 16
+  addi sp, sp, 16
+  ret
+  .cfi_endproc
+
+.section .eh_frame,"a",@progbits
+.globl c_cie, c_fde
+c_cie:
+.set c_fde, c_cie + 0x30
+
+.data
+.p2align 3
+  .quad c_cie, c_fde
+EOF
+
+# c.o的.eh_frame是一个CIE和两个FDE，c_fde指向第二个FDE中的函数起始地址字段
+readelf -wf "$t"/c.o | grep -q '^00000028 .* FDE cie=00000000'
+
+$CC -B. -nostdlib -static "$t"/a.o "$t"/c.o -o "$t"/out4
+set -- $(readelf -SW "$t"/out4 | sed 's/^ *\[ *[0-9]*\]//' | awk '$1 == ".eh_frame" { print $3 }')
+bar2=$(readelf -sW "$t"/out4 | awk '$8 == "bar2" { print $2 }')
+fde=$(readelf -wf "$t"/out4 | awk -v pc="pc=$bar2.." 'index($0, pc) { print $1 }')
+readelf -sW "$t"/out4 | grep -q " $(printf '%016x' $((0x$1))) .* c_cie$"
+readelf -sW "$t"/out4 | grep -q " $(printf '%016x' $((0x$1 + 0x$fde + 8))) .* c_fde$"
+
+# FDE的第一个重定位必须指向函数所在的段，SHN_ABS这类保留的段下标要报错而不是越界
+cat <<EOF | $CC -o "$t"/d.o -c -xassembler -
+.globl _start, abs_sym
+_start:
+  ret
+.set abs_sym, 0x1000
+
+.section .eh_frame,"a",@progbits
+cie:
+  .4byte 0x10
+  .4byte 0
+  .byte 1
+  .asciz "zR"
+  .byte 1, 0x7c, 1, 1, 0x1b, 0x0c, 2, 0
+  .4byte 0x10
+  .4byte . - cie
+  .4byte abs_sym - .
+  .4byte 4
+  .byte 0, 0, 0, 0
+EOF
+
+# 汇编器把对绝对符号的重定位换成了0号符号，这里把它改回abs_sym
+off=$(readelf -SW "$t"/d.o | sed 's/^ *\[ *[0-9]*\]//' | awk '$1 == ".rela.eh_frame" { print $4 }')
+idx=$(readelf -sW "$t"/d.o | awk '$8 == "abs_sym" { print $1 }' | tr -d :)
+printf "\\x$(printf '%02x' $idx)" | dd of="$t"/d.o bs=1 seek=$((0x$off + 12)) conv=notrunc status=none
+readelf -rW "$t"/d.o | grep -q 'R_RISCV_32_PCREL .* abs_sym'
+
+status=0
+$CC -B. -nostdlib -static "$t"/d.o -o "$t"/out5 > "$t"/log 2>&1 || status=$?
+[ $status -eq 1 ]
+grep -q 'd.o: .eh_frame: FDE is not attached to any section' "$t"/log
@@ -0,0 +1,46 @@
+#!/bin/bash
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+mkdir -p "$t"
+
+# 需要linux-gnu工具链中的libc和动态链接器，没有时跳过
+CC=${LINUX_CC:-riscv64-linux-gnu-gcc}
+if ! command -v "$CC" > /dev/null || ! command -v qemu-riscv64 > /dev/null; then
+  echo "skipped: $CC or qemu-riscv64 not found"
+  exit 0
+fi
+
+# 通过数据中的函数指针调用libc，由动态链接器填入它们的地址
+cat <<EOF | $CC -o "$t"/a.o -c -xc -fno-PIC -
+#include <stdio.h>
+#include <stdlib.h>
+
+static int (*volatile puts_ptr)(const char *) = puts;
+static void (*volatile exit_ptr)(int) = exit;
+
+void _start(void) {
+  puts_ptr("Hello World!");
+  exit_ptr(0);
+}
+EOF
+
+$CC -B. -nostartfiles -no-pie "$t"/a.o -o "$t"/out
+readelf -lW "$t"/out | grep -q 'Requesting program interpreter'
+readelf -dW "$t"/out | grep -q 'Shared library: \[libc.so.6\]'
+qemu-riscv64 "$t"/out | grep -q 'Hello World!'
+
+# 普通的main和printf，启动代码和printf都要经过PLT
+cat <<EOF | $CC -o "$t"/b.o -c -xc -fno-PIC -
+#include <stdio.h>
+
+int main(void) {
+  printf("Hello World!\n");
+  return 0;
+}
+EOF
+
+$CC -B. -no-pie "$t"/b.o -o "$t"/out2
+readelf -rW "$t"/out2 | grep -q 'R_RISCV_JUMP_SLOT.* printf'
+qemu-riscv64 "$t"/out2 | grep -q 'Hello World!'
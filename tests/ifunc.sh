@@ -0,0 +1,54 @@
+#!/bin/bash
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+mkdir -p "$t"
+
+# crt中的启动代码用__rela_iplt_start和__rela_iplt_end找到IRELATIVE重定位
+cat <<EOF | $CC -o "$t"/a.o -c -xassembler -
+.globl _start
+_start:
+  call foo
+  la a0, __rela_iplt_start
+  la a1, __rela_iplt_end
+  ret
+
+.globl foo
+.type foo, @gnu_indirect_function
+foo:
+  lla a0, foo_impl
+  ret
+
+foo_impl:
+  ret
+EOF
+
+$CC -B. -nostdlib -static "$t"/a.o -o "$t"/out
+readelf -rW "$t"/out | grep -q 'R_RISCV_IRELATIVE'
+readelf -sW "$t"/out | grep -q ' __rela_iplt_start$'
+readelf -sW "$t"/out | grep -q ' __rela_iplt_end$'
+
+# 动态链接的输出中不支持IFUNC
+$CC -B. -nostdlib -pie "$t"/a.o -o "$t"/out2 > "$t"/log 2>&1 || true
+grep -q 'IFUNC symbol foo is only supported in static executables' "$t"/log
+
+# 局部的IFUNC符号同样要通过.iplt调用
+cat <<EOF | $CC -o "$t"/b.o -c -xassembler -
+.globl _start
+_start:
+  call bar
+  ret
+
+.type bar, @gnu_indirect_function
+bar:
+  lla a0, bar_impl
+  ret
+
+bar_impl:
+  ret
+EOF
+
+$CC -B. -nostdlib -static "$t"/b.o -o "$t"/out3
+readelf -rW "$t"/out3 | grep -q 'R_RISCV_IRELATIVE'
+readelf -SW "$t"/out3 | grep -q ' \.iplt '
@@ -0,0 +1,51 @@
+#!/bin/bash
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+mkdir -p "$t"/lib1 "$t"/lib2 "$t"/sysroot/lib
+
+cat <<EOF | $CC -o "$t"/a.o -c -xassembler -
+.globl _start
+_start:
+  call foo
+  ret
+EOF
+
+cat <<EOF | $CC -o "$t"/foo.o -c -xassembler -
+.globl foo
+foo:
+  ret
+EOF
+
+rm -f "$t"/lib1/libfoo.a "$t"/lib2/libbar.a "$t"/sysroot/lib/libfoo.a
+ar rcs "$t"/lib1/libfoo.a "$t"/foo.o
+ar rcs "$t"/lib2/libbar.a "$t"/foo.o
+ar rcs "$t"/sysroot/lib/libfoo.a "$t"/foo.o
+
+# -l:NAME只找给定的文件名，按-L的顺序搜索各个目录
+./ld -static "$t"/a.o -L"$t"/lib1 -L"$t"/lib2 -l:libbar.a -o "$t"/out -t > "$t"/log
+grep -q "^$t/lib2/libbar.a(foo.o)$" "$t"/log
+
+./ld -static "$t"/a.o -L"$t"/lib1 -l:libbar.a -o "$t"/out > "$t"/log 2>&1 || true
+grep -q 'library not found: -l:libbar.a' "$t"/log
+
+# 以=开头的-L相对于--sysroot
+./ld -static "$t"/a.o --sysroot="$t"/sysroot -L=/lib -lfoo -o "$t"/out -t > "$t"/log
+grep -q "^$t/sysroot/lib/libfoo.a(foo.o)$" "$t"/log
+
+# 链接脚本中的SEARCH_DIR和-L一样
+cat <<EOF > "$t"/script
+SEARCH_DIR($t/lib1)
+INPUT(-lfoo)
+EOF
+./ld -static "$t"/a.o "$t"/script -o "$t"/out -t > "$t"/log
+grep -q "^$t/lib1/libfoo.a(foo.o)$" "$t"/log
+
+# -nostdlib时只搜索命令行中给出的目录
+./ld -static -nostdlib "$t"/a.o -L"$t"/lib2 -lfoo -o "$t"/out > "$t"/log 2>&1 || true
+[ "$(grep -c 'tried' "$t"/log)" -eq 1 ]
+
+# -rpath变成DT_RUNPATH
+./ld -pie "$t"/a.o "$t"/foo.o -rpath /foo -rpath /bar -o "$t"/out
+readelf -dW "$t"/out | grep -q 'Library runpath: \[/foo:/bar\]'
@@ -0,0 +1,49 @@
+#!/bin/bash
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+mkdir -p "$t"
+
+cat <<EOF | $CC -o "$t"/a.o -c -xassembler -fPIC -
+.globl _start
+_start:
+  ret
+
+.data
+.p2align 3
+.quad _etext, _edata, __bss_start, _end, __start_mysec, __stop_mysec
+
+.section mysec,"aw",@progbits
+.word 1, 2, 3
+
+.bss
+.zero 32
+EOF
+
+# 链接器提供的符号不会被当作未定义符号
+./ld -static "$t"/a.o -o "$t"/out
+
+# 输出段的起始地址和结束地址
+section() {
+  set -- $(readelf -SW "$t"/out | sed 's/^ *\[ *[0-9]*\]//' | awk -v name=$1 '$1 == name { print $3, $5 }')
+  printf '%016x %016x\n' $((0x$1)) $((0x$1 + 0x$2))
+}
+
+symbol() {
+  readelf -sW "$t"/out | awk -v name=$1 '$8 == name { print $2 }'
+}
+
+read text_start text_end < <(section .text)
+read mysec_start mysec_end < <(section mysec)
+read bss_start bss_end < <(section .bss)
+[ "$(symbol _etext)" = $text_end ]
+[ "$(symbol _edata)" = $mysec_end ]
+[ "$(symbol __bss_start)" = $bss_start ]
+[ "$(symbol _end)" = $bss_end ]
+[ "$(symbol __start_mysec)" = $mysec_start ]
+[ "$(symbol __stop_mysec)" = $mysec_end ]
+
+# 位置无关的输出文件中它们的地址要加上加载基址
+./ld -pie "$t"/a.o -o "$t"/out2
+[ "$(readelf -rW "$t"/out2 | grep -c R_RISCV_RELATIVE)" -eq 6 ]
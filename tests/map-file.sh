@@ -0,0 +1,39 @@
+#!/bin/bash
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+mkdir -p "$t"
+
+cat <<EOF | $CC -o "$t"/a.o -c -xassembler -
+.globl _start
+_start:
+  call foo
+  ret
+EOF
+
+cat <<EOF | $CC -o "$t"/foo.o -c -xassembler -
+.globl foo
+foo:
+  ret
+EOF
+
+rm -f "$t"/libfoo.a
+ar rcs "$t"/libfoo.a "$t"/foo.o
+
+./ld -static "$t"/a.o "$t"/libfoo.a -o "$t"/out -Map "$t"/map
+
+# 链接映射中有拉入归档成员的原因、输入段的位置和符号的地址
+grep -q '^Archive member included to satisfy reference by file (symbol)$' "$t"/map
+grep -q "^$t/libfoo.a(foo.o)$" "$t"/map
+grep -q "^ \+$t/a.o (foo)$" "$t"/map
+grep -q '^Memory map$' "$t"/map
+grep -q "^ .text .* $t/libfoo.a(foo.o)$" "$t"/map
+grep -Eq '^ +0x[0-9a-f]+ +_start$' "$t"/map
+grep -Eq '^ +0x[0-9a-f]+ +foo$' "$t"/map
+
+# -Map=FILE的写法，-M打印到标准输出
+./ld -static "$t"/a.o "$t"/libfoo.a -o "$t"/out -Map="$t"/map2
+cmp "$t"/map "$t"/map2
+./ld -static "$t"/a.o "$t"/libfoo.a -o "$t"/out -M > "$t"/log
+cmp "$t"/map "$t"/log
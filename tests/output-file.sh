@@ -0,0 +1,30 @@
+#!/bin/bash
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+mkdir -p "$t"
+
+cat <<EOF | $CC -o "$t"/a.o -c -xassembler -
+.globl _start
+_start:
+  ret
+EOF
+
+./ld -static "$t"/a.o -o "$t"/out
+[ -x "$t"/out ]
+
+# 已经存在的更大的输出文件被整个替换，而不是在原来的文件上改写
+rm -f "$t"/out2 "$t"/out2.link
+head -c 100000 /dev/zero > "$t"/out2
+ln "$t"/out2 "$t"/out2.link
+./ld -static "$t"/a.o -o "$t"/out2
+cmp "$t"/out "$t"/out2
+[ "$(stat -c %s "$t"/out2.link)" -eq 100000 ]
+
+# 临时文件在重命名之后不会留在输出目录中
+[ "$(ls "$t" | wc -l)" -eq 4 ]
+
+# 不是普通文件的输出直接写入
+./ld -static "$t"/a.o -o /dev/null
+[ -c /dev/null ]
@@ -0,0 +1,69 @@
+#!/bin/bash
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+mkdir -p "$t"
+
+# 动态链接需要linux-gnu工具链，没有时跳过
+CC=${LINUX_CC:-riscv64-linux-gnu-gcc}
+if ! command -v "$CC" > /dev/null; then
+  echo "skipped: $CC not found"
+  exit 0
+fi
+
+# PIE中数据里的绝对地址变成R_RISCV_RELATIVE
+cat <<EOF | $CC -o "$t"/a.o -c -xassembler -fPIC -
+.globl _start
+_start:
+  lla a0, ptr
+  ret
+
+.data
+.p2align 3
+ptr:
+  .quad _start
+  .quad ptr
+EOF
+
+$CC -B. -nostdlib -pie "$t"/a.o -o "$t"/out
+readelf -hW "$t"/out | grep -q 'DYN'
+readelf -dW "$t"/out | grep -q 'PIE'
+[ "$(readelf -rW "$t"/out | grep -c R_RISCV_RELATIVE)" -eq 2 ]
+readelf -lW "$t"/out | grep -Eq 'LOAD +0x0+ 0x0+ '
+
+# --pack-dyn-relocs=relr把相对重定位压缩到.relr.dyn中
+$CC -B. -nostdlib -pie "$t"/a.o -o "$t"/out2 -Wl,--pack-dyn-relocs=relr
+readelf -SW "$t"/out2 | grep -q ' \.relr\.dyn '
+readelf -dW "$t"/out2 | grep -q '(RELR)'
+! readelf -rW "$t"/out2 | grep -q 'R_RISCV_RELATIVE' || false
+
+# R_RISCV_32放不下加载基址，只能用于绝对符号
+cat <<EOF | $CC -o "$t"/b.o -c -xassembler -
+.globl abs
+.set abs, 0x1234
+EOF
+
+cat <<EOF | $CC -o "$t"/c.o -c -xassembler -fPIC -
+.globl _start
+_start:
+  ret
+
+.data
+.word abs
+EOF
+
+cat <<EOF | $CC -o "$t"/d.o -c -xassembler -fPIC -
+.globl _start
+_start:
+  ret
+
+.data
+local:
+.word local
+EOF
+
+$CC -B. -nostdlib -pie "$t"/b.o "$t"/c.o -o "$t"/out3
+$CC -B. -nostdlib -pie "$t"/d.o -o "$t"/out4 > "$t"/log 2>&1 || true
+grep -q "relocation R_RISCV_32 against \`local' can not be used" "$t"/log
+grep -q 'recompile with -fPIC' "$t"/log
@@ -0,0 +1,47 @@
+#!/bin/bash
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+mkdir -p "$t"
+
+# 动态库用linux-gnu工具链自己的链接器生成，没有这个工具链时跳过
+CC=${LINUX_CC:-riscv64-linux-gnu-gcc}
+if ! command -v "$CC" > /dev/null; then
+  echo "skipped: $CC not found"
+  exit 0
+fi
+
+cat <<EOF | $CC -o "$t"/foo.o -c -xassembler -fPIC -
+.globl foo, bar
+foo:
+  ret
+bar:
+  ret
+EOF
+
+$CC -nostdlib -shared "$t"/foo.o -o "$t"/libfoo.so -Wl,-soname,libfoo.so
+
+# 调用动态库中的函数要经过PLT
+cat <<EOF | $CC -o "$t"/a.o -c -xassembler -
+.globl _start
+_start:
+  call foo
+  call bar
+  call foo
+  ret
+EOF
+
+$CC -B. -nostdlib "$t"/a.o "$t"/libfoo.so -o "$t"/out
+readelf -SW "$t"/out | grep -q ' \.plt '
+readelf -SW "$t"/out | grep -q ' \.got\.plt '
+readelf -dW "$t"/out | grep -q '(PLTGOT)'
+readelf -dW "$t"/out | grep -q '(JMPREL)'
+readelf -rW "$t"/out | grep -q 'R_RISCV_JUMP_SLOT.* foo'
+readelf -rW "$t"/out | grep -q 'R_RISCV_JUMP_SLOT.* bar'
+[ "$(readelf -rW "$t"/out | grep -c R_RISCV_JUMP_SLOT)" -eq 2 ]
+! readelf -dW "$t"/out | grep -q 'BIND_NOW' || false
+
+# -z now时在加载时就解析所有的函数
+$CC -B. -nostdlib "$t"/a.o "$t"/libfoo.so -o "$t"/out -Wl,-z,now
+readelf -dW "$t"/out | grep -q 'BIND_NOW'
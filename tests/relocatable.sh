@@ -0,0 +1,74 @@
+#!/bin/bash
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+mkdir -p "$t"
+
+cat <<EOF | $CC -o "$t"/a.o -c -xassembler -
+.attribute stack_align, 16
+.attribute arch, "rv64i2p0_m2p0"
+.globl _start
+_start:
+  call foo
+  ret
+EOF
+
+cat <<EOF | $CC -o "$t"/b.o -c -xassembler -
+.attribute stack_align, 8
+.attribute arch, "rv64i2p0_a2p0"
+.globl foo
+foo:
+  la a0, bar
+  ret
+
+.data
+bar:
+  .quad foo
+EOF
+
+# -r合并输入文件，保留重定位和符号，.riscv.attributes取各个文件的并集
+./ld -r "$t"/a.o "$t"/b.o -o "$t"/c.o
+readelf -hW "$t"/c.o | grep -q 'Type: *REL '
+readelf -sW "$t"/c.o | grep -q 'GLOBAL DEFAULT .* _start$'
+readelf -sW "$t"/c.o | grep -q 'GLOBAL DEFAULT .* foo$'
+readelf -rW "$t"/c.o | grep -Eq 'R_RISCV_CALL(_PLT)? .* foo'
+readelf -rW "$t"/c.o | grep -q 'R_RISCV_64 .* foo'
+readelf -AW "$t"/c.o | grep -Eq 'Tag_RISCV_arch: "rv64i[0-9p]+_m[0-9p]+_.*a[0-9p]+'
+readelf -AW "$t"/c.o | grep -q 'Tag_RISCV_stack_align: 16-bytes'
+[ "$(readelf -SW "$t"/c.o | grep -c '\.riscv\.attributes')" -eq 1 ]
+
+# -r的输出可以作为最终链接的输入
+./ld -static "$t"/c.o -o "$t"/out
+readelf -sW "$t"/out | grep -q ' foo$'
+
+status=0
+./ld -r -shared "$t"/a.o -o "$t"/d.o 2> "$t"/log || status=$?
+[ $status -eq 1 ]
+grep -q -- '-r and -shared may not be used together' "$t"/log
+
+# 不同的基础指令集不能合并
+cat <<EOF | $CC -o "$t"/e.o -c -xassembler -
+.attribute arch, "rv32i2p0"
+EOF
+
+./ld -r "$t"/a.o "$t"/e.o -o "$t"/f.o 2> "$t"/log || true
+grep -q 'conflicting Tag_RISCV_arch: rv64i.* vs rv32i' "$t"/log
+
+# .llvm_addrsig中存放的是输入文件中的符号下标，-r时会被丢掉，
+# 定义在其中的符号和对它的引用都无法输出
+cat <<EOF | $CC -o "$t"/g.o -c -xassembler -
+.globl baz
+.section .llvm_addrsig,"",@0x6fff4c03
+baz:
+  .byte 0
+
+.data
+.quad baz
+EOF
+
+status=0
+./ld -r "$t"/g.o -o "$t"/h.o 2> "$t"/log || status=$?
+[ $status -eq 1 ]
+grep -q 'symbol baz is defined in discarded section .llvm_addrsig' "$t"/log
+grep -q '.data+0x0: relocation refers to a symbol in a discarded section: baz' "$t"/log
@@ -0,0 +1,51 @@
+#!/bin/bash
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+mkdir -p "$t"/'a dir'
+
+cat <<EOF | $CC -o "$t"/'a dir'/a.o -c -xassembler -
+.globl _start
+_start:
+  ret
+EOF
+
+# 响应文件中的引号和反斜杠，以及嵌套的响应文件
+cat <<EOF > "$t"/rsp2
+-o $t/out\\ file
+EOF
+
+cat <<EOF > "$t"/rsp
+-pie "$t/a dir/a.o"
+-rpath '/foo bar' @$t/rsp2
+EOF
+
+rm -f "$t"/'out file'
+./ld @"$t"/rsp
+readelf -dW "$t"/'out file' | grep -q 'Library runpath: \[/foo bar\]'
+
+# 互相引用的响应文件报错
+echo "@$t/rsp4" > "$t"/rsp3
+echo "@$t/rsp3" > "$t"/rsp4
+status=0
+./ld @"$t"/rsp3 2> "$t"/log || status=$?
+[ $status -eq 1 ]
+grep -q 'recursive response file' "$t"/log
+
+# 链接器自己也按逗号拆分-Wl,后面的选项
+./ld -pie "$t"/'a dir'/a.o -o "$t"/out -Wl,-rpath,/baz,-z,now
+readelf -dW "$t"/out | grep -q 'Library runpath: \[/baz\]'
+readelf -dW "$t"/out | grep -q 'BIND_NOW'
+
+# 未知的-z选项只是警告
+./ld -pie "$t"/'a dir'/a.o -o "$t"/out -z foo 2> "$t"/log
+grep -q 'warning: unknown -z option: foo' "$t"/log
+
+# 和GNU ld一样，--threads后面单独的参数是输入文件
+./ld -pie "$t"/'a dir'/a.o -o "$t"/out --threads 4 2> "$t"/log || true
+grep -q 'open 4: no such file or directory' "$t"/log
+./ld -pie "$t"/'a dir'/a.o -o "$t"/out -threads=2
+
+./ld --help | grep -q '^Usage: '
+./ld --help | grep -q -- '--threads\[=N\]'
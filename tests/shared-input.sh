@@ -0,0 +1,87 @@
+#!/bin/bash
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+mkdir -p "$t"/lib
+
+# 动态库用linux-gnu工具链自己的链接器生成，没有这个工具链时跳过
+CC=${LINUX_CC:-riscv64-linux-gnu-gcc}
+if ! command -v "$CC" > /dev/null; then
+  echo "skipped: $CC not found"
+  exit 0
+fi
+
+cat <<EOF | $CC -o "$t"/a.o -c -xassembler -
+.globl _start
+_start:
+  call foo
+  call bar
+  ret
+EOF
+
+cat <<EOF | $CC -o "$t"/foo.o -c -xassembler -fPIC -
+.globl foo
+foo:
+  ret
+EOF
+
+cat <<EOF | $CC -o "$t"/bar.o -c -xassembler -
+.globl bar
+bar:
+  call baz
+  ret
+EOF
+
+cat <<EOF | $CC -o "$t"/baz.o -c -xassembler -
+.globl baz
+baz:
+  call bar
+  ret
+EOF
+
+$CC -nostdlib -shared "$t"/foo.o -o "$t"/lib/libfoo.so -Wl,-soname,libfoo.so
+rm -f "$t"/libbar.a "$t"/libbaz.a
+ar rcs "$t"/libbar.a "$t"/bar.o
+ar rcs "$t"/libbaz.a "$t"/baz.o
+
+# -lfoo在没有-Bstatic时也会找libfoo.so
+./ld "$t"/a.o -L"$t"/lib -lfoo "$t"/libbar.a "$t"/libbaz.a -o "$t"/out > "$t"/log 2>&1
+! grep -q 'library not found' "$t"/log || false
+
+./ld "$t"/a.o -L"$t"/lib -Bstatic -lfoo -o "$t"/out > "$t"/log 2>&1 || true
+grep -q 'library not found' "$t"/log
+
+./ld -static "$t"/a.o -L"$t"/lib -lfoo -o "$t"/out > "$t"/log 2>&1 || true
+grep -q 'library not found' "$t"/log
+
+./ld "$t"/a.o -L"$t"/lib -Bstatic -Bdynamic -lfoo "$t"/libbar.a "$t"/libbaz.a \
+  -o "$t"/out > "$t"/log 2>&1
+! grep -q 'library not found' "$t"/log || false
+
+# 文本文件作为链接脚本读入，GROUP中的归档文件可以互相引用
+echo "GROUP ( $t/libbar.a $t/libbaz.a )" > "$t"/libgroup.so
+./ld "$t"/a.o "$t"/lib/libfoo.so "$t"/libgroup.so -o "$t"/out --warn-backrefs \
+  > "$t"/log 2>&1
+! grep -q 'backward reference' "$t"/log || false
+
+cat <<EOF > "$t"/script
+/* 注释 */
+INPUT($t/lib/libfoo.so)
+GROUP($t/libbar.a $t/libbaz.a)
+EOF
+./ld "$t"/a.o "$t"/script -o "$t"/out --warn-backrefs > "$t"/log 2>&1
+! grep -q 'backward reference' "$t"/log || false
+
+# INPUT中的文件和直接写在命令行上一样，不会被当成一个group
+echo "INPUT($t/libbaz.a $t/libbar.a)" > "$t"/script
+status=0
+./ld "$t"/a.o "$t"/lib/libfoo.so "$t"/script -o "$t"/out --warn-backrefs \
+  > "$t"/log 2>&1 || status=$?
+[ $status -eq 1 ]
+grep -q 'undefined symbol: baz' "$t"/log
+grep -q 'backward reference detected: baz in .*libbar.a(bar.o) refers to .*libbaz.a(baz.o)' "$t"/log
+
+./ld "$t"/a.o "$t"/lib/libfoo.so --start-group "$t"/script --end-group \
+  -o "$t"/out --warn-backrefs > "$t"/log 2>&1
+! grep -q 'backward reference' "$t"/log || false
@@ -0,0 +1,77 @@
+#!/bin/bash
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+mkdir -p "$t"
+
+# 动态链接需要linux-gnu工具链，没有时跳过
+CC=${LINUX_CC:-riscv64-linux-gnu-gcc}
+if ! command -v "$CC" > /dev/null; then
+  echo "skipped: $CC not found"
+  exit 0
+fi
+
+# 动态库中用general dynamic模型访问自己的和外部的TLS变量
+cat <<EOF | $CC -o "$t"/a.o -c -xassembler -fPIC -
+.globl get_foo, hidden_fn
+.hidden hidden_fn
+get_foo:
+  la.tls.gd a0, foo
+  call __tls_get_addr@plt
+  la.tls.gd a0, ext
+  call __tls_get_addr@plt
+  ret
+hidden_fn:
+  ret
+
+.section .tdata,"awT",@progbits
+.globl foo
+.type foo, @object
+foo:
+  .word 3
+EOF
+
+$CC -B. -nostdlib -shared "$t"/a.o -o "$t"/libfoo.so -Wl,-soname,libfoo.so
+readelf -hW "$t"/libfoo.so | grep -q 'DYN'
+readelf -dW "$t"/libfoo.so | grep -q 'Library soname: \[libfoo.so\]'
+readelf -lW "$t"/libfoo.so | grep -q ' TLS '
+readelf -rW "$t"/libfoo.so | grep -q 'R_RISCV_TLS_DTPMOD64.* foo'
+readelf -rW "$t"/libfoo.so | grep -q 'R_RISCV_TLS_DTPREL64.* ext'
+readelf -rW "$t"/libfoo.so | grep -q 'R_RISCV_JUMP_SLOT.* __tls_get_addr'
+
+# 只导出默认可见性的全局符号
+readelf -W --dyn-syms "$t"/libfoo.so > "$t"/log
+grep -q ' get_foo$' "$t"/log
+! grep -q ' hidden_fn$' "$t"/log || false
+
+# 局部的TLS变量不需要符号，模块内的偏移直接写在重定位的加数中
+cat <<EOF | $CC -o "$t"/b.o -c -xassembler -fPIC -
+.globl get_bar
+get_bar:
+  la.tls.ie a0, bar
+  la.tls.gd a0, bar
+  ret
+
+.section .tdata,"awT",@progbits
+.zero 8
+bar:
+  .quad 5
+EOF
+
+$CC -B. -nostdlib -shared "$t"/b.o -o "$t"/libbar.so
+readelf -rW "$t"/libbar.so > "$t"/log
+grep -Eq 'R_RISCV_TLS_TPREL64 +8$' "$t"/log
+grep -Eq 'R_RISCV_TLS_DTPMOD64 +0$' "$t"/log
+[ "$(grep -c R_RISCV_TLS "$t"/log)" -eq 2 ]
+
+# 动态库中不能使用local exec模型
+cat <<EOF | $CC -o "$t"/c.o -c -xassembler -
+.globl baz
+baz:
+  lui a0, %tprel_hi(foo)
+  ret
+EOF
+
+$CC -B. -nostdlib -shared "$t"/c.o "$t"/a.o -o "$t"/libbaz.so > "$t"/log 2>&1 || true
+grep -q "against \`foo' can not be used when making a shared object; recompile with -fPIC" "$t"/log
@@ -0,0 +1,37 @@
+#!/bin/bash
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+mkdir -p "$t"
+
+# 8个文件，每个文件中有200个函数段和一些可合并的字符串，每个函数都调用下一个文件中对应的函数
+for i in $(seq 0 7); do
+  {
+    [ $i -eq 0 ] && echo -e '.text\n.globl _start\n_start:\n  call f0_0\n  ret'
+    for j in $(seq 0 199); do
+      echo ".section .text.f${i}_$j,\"ax\",@progbits"
+      echo ".globl f${i}_$j"
+      echo "f${i}_$j:"
+      echo "  call f$(((i + 1) % 8))_$j"
+      echo "  ret"
+      echo ".section .rodata.str,\"aMS\",@progbits,1"
+      echo ".string \"str$j\""
+    done
+  } | $CC -o "$t"/$i.o -c -xassembler -
+done
+
+# 输出的内容和线程数无关
+for n in 1 2 8; do
+  ./ld -static "$t"/[0-7].o -o "$t"/out.$n --threads=$n
+done
+cmp "$t"/out.1 "$t"/out.2
+cmp "$t"/out.1 "$t"/out.8
+
+./ld -static "$t"/[0-7].o -o "$t"/out.none --no-threads
+cmp "$t"/out.1 "$t"/out.none
+./ld -static "$t"/[0-7].o -o "$t"/out.all --threads
+cmp "$t"/out.1 "$t"/out.all
+
+./ld -static "$t"/[0-7].o -o "$t"/out --threads=0 > "$t"/log 2>&1 || true
+grep -q -- '--threads: expected .*, but got: 0' "$t"/log
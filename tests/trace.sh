@@ -0,0 +1,43 @@
+#!/bin/bash
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+mkdir -p "$t"/lib1 "$t"/lib2
+
+cat <<EOF | $CC -o "$t"/a.o -c -xassembler -
+.globl _start
+_start:
+  call foo
+  ret
+EOF
+
+cat <<EOF | $CC -o "$t"/foo.o -c -xassembler -
+.globl foo
+foo:
+  ret
+EOF
+
+cat <<EOF | $CC -o "$t"/bar.o -c -xassembler -
+.globl bar
+bar:
+  ret
+EOF
+
+rm -f "$t"/lib1/libfoo.a
+ar rcs "$t"/lib1/libfoo.a "$t"/foo.o "$t"/bar.o
+
+# -t只打印实际加载的文件和归档成员
+./ld -static "$t"/a.o -L"$t"/lib1 -lfoo -o "$t"/out -t > "$t"/log
+grep -q "^$t/a.o$" "$t"/log
+grep -q "^$t/lib1/libfoo.a(foo.o)$" "$t"/log
+! grep -q 'bar.o' "$t"/log || false
+
+./ld -static "$t"/a.o -L"$t"/lib1 -lfoo -o "$t"/out --trace > "$t"/log2
+cmp "$t"/log "$t"/log2
+
+# 找不到库时列出尝试过的每一个路径
+./ld -static "$t"/a.o -L"$t"/lib2 -L"$t"/lib1 -lbaz -o "$t"/out > "$t"/log 2>&1 || true
+grep -q 'library not found: -lbaz' "$t"/log
+grep -q "$t/lib2/libbaz.a" "$t"/log
+grep -q "$t/lib1/libbaz.a" "$t"/log
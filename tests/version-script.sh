@@ -0,0 +1,107 @@
+#!/bin/bash
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+mkdir -p "$t"
+
+# 动态链接需要linux-gnu工具链，没有时跳过
+CC=${LINUX_CC:-riscv64-linux-gnu-gcc}
+if ! command -v "$CC" > /dev/null; then
+  echo "skipped: $CC not found"
+  exit 0
+fi
+
+cat <<EOF | $CC -o "$t"/a.o -c -xassembler -fPIC -
+.globl foo, foo2, bar, baz
+foo:
+  ret
+foo2:
+  ret
+bar:
+  ret
+baz:
+  ret
+EOF
+
+# 单独的*优先级最低，[!...]表示取反
+cat <<EOF > "$t"/ver.map
+VER_1 { global: *; local: ba[!r]; };
+VER_2 { global: foo2; } VER_1;
+EOF
+
+$CC -B. -nostdlib -shared "$t"/a.o -o "$t"/libfoo.so -Wl,--version-script,"$t"/ver.map
+readelf -W --dyn-syms "$t"/libfoo.so > "$t"/log
+grep -q ' foo@@VER_1$' "$t"/log
+grep -q ' foo2@@VER_2$' "$t"/log
+grep -q ' bar@@VER_1$' "$t"/log
+! grep -q ' baz' "$t"/log || false
+
+readelf -W -V "$t"/libfoo.so | grep -q 'Parent 1: VER_1'
+
+# 引用带版本的符号时记录所需的版本
+cat <<EOF | $CC -o "$t"/b.o -c -xassembler -
+.globl _start
+_start:
+  call foo2
+  ret
+EOF
+
+$CC -B. -nostdlib "$t"/b.o "$t"/libfoo.so -o "$t"/out
+readelf -W -V "$t"/out | grep -q 'Name: VER_2'
+
+# .symver给同名符号的不同实现指定版本，@@表示默认版本
+cat <<EOF | $CC -o "$t"/c.o -c -xassembler -fPIC -
+.globl old_qux, new_qux
+.symver old_qux, qux@VER_1
+.symver new_qux, qux@@VER_2
+old_qux:
+  ret
+new_qux:
+  ret
+EOF
+
+cat <<EOF > "$t"/ver2.map
+VER_1 { local: *; };
+VER_2 { } VER_1;
+EOF
+
+$CC -B. -nostdlib -shared "$t"/c.o -o "$t"/libqux.so -Wl,--version-script,"$t"/ver2.map
+readelf -W --dyn-syms "$t"/libqux.so > "$t"/log
+grep -q ' qux@VER_1$' "$t"/log
+grep -q ' qux@@VER_2$' "$t"/log
+
+# extern "C++"的块会被忽略，但不影响同一个脚本中的其他模式
+cat <<EOF > "$t"/ver3.map
+VER_1 {
+  global:
+    extern "C" { foo; };
+    extern "C++" { ns::*; "bar()"; };
+  local: *;
+};
+EOF
+
+$CC -B. -nostdlib -shared "$t"/a.o -o "$t"/libfoo3.so -Wl,--version-script,"$t"/ver3.map \
+  > "$t"/log 2>&1
+grep -q 'extern "C++" is not supported' "$t"/log
+readelf -W --dyn-syms "$t"/libfoo3.so > "$t"/log
+grep -q ' foo@@VER_1$' "$t"/log
+! grep -q ' bar' "$t"/log || false
+
+# .symver引用了版本脚本中没有定义的版本
+cat <<EOF | $CC -o "$t"/d.o -c -xassembler -fPIC -
+.globl quux1, quux2
+.symver quux1, quux@@VER_X
+.symver quux2, corge@@VER_Y
+quux1:
+  ret
+quux2:
+  ret
+EOF
+
+status=0
+$CC -B. -nostdlib -shared "$t"/d.o -o "$t"/libquux.so -Wl,--version-script,"$t"/ver2.map \
+  > "$t"/log 2>&1 || status=$?
+[ $status -eq 1 ]
+grep -q 'd.o: symbol quux has undefined version VER_X' "$t"/log
+grep -q 'd.o: symbol corge has undefined version VER_Y' "$t"/log
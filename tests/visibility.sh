@@ -0,0 +1,85 @@
+#!/bin/bash
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+mkdir -p "$t"
+
+# 动态链接需要linux-gnu工具链，没有时跳过
+CC=${LINUX_CC:-riscv64-linux-gnu-gcc}
+if ! command -v "$CC" > /dev/null; then
+  echo "skipped: $CC not found"
+  exit 0
+fi
+
+cat <<EOF | $CC -o "$t"/a.o -c -xassembler -fPIC -
+.globl foo, bar, baz, qux
+.hidden foo
+.protected bar
+.internal baz
+foo:
+  ret
+bar:
+  ret
+baz:
+  ret
+qux:
+  call bar
+  ret
+EOF
+
+# 只导出default和protected的符号，对protected符号的调用不经过PLT
+$CC -B. -nostdlib -shared "$t"/a.o -o "$t"/libfoo.so
+readelf -W --dyn-syms "$t"/libfoo.so > "$t"/log
+! grep -q ' foo$' "$t"/log || false
+grep -q 'PROTECTED .* bar$' "$t"/log
+! grep -q ' baz$' "$t"/log || false
+grep -q ' qux$' "$t"/log
+! readelf -rW "$t"/libfoo.so | grep -q 'JUMP_SLOT' || false
+
+# .symtab中隐藏的符号变成局部符号
+readelf -sW "$t"/libfoo.so | grep -q 'LOCAL .* HIDDEN .* foo$'
+readelf -sW "$t"/libfoo.so | grep -q 'LOCAL .* INTERNAL .* baz$'
+
+# 可见性取所有文件中最严格的那个
+cat <<EOF | $CC -o "$t"/b.o -c -xassembler -fPIC -
+.globl qux
+.hidden qux
+  call qux
+EOF
+
+$CC -B. -nostdlib -shared "$t"/a.o "$t"/b.o -o "$t"/libfoo2.so
+! readelf -W --dyn-syms "$t"/libfoo2.so | grep -q ' qux$' || false
+
+# 和libc.a中的启动代码一样，以隐藏的未定义符号引用.init_array的开始和结尾
+cat <<EOF | $CC -o "$t"/c.o -c -xassembler -
+.globl _start
+_start:
+  ret
+
+.hidden __init_array_start, __init_array_end
+.data
+.quad __init_array_start
+.quad __init_array_end
+
+.section .init_array,"aw",@init_array
+.quad 0, 0, 0
+EOF
+
+$CC -B. -nostdlib -static "$t"/c.o -o "$t"/out
+sec=$(readelf -SW "$t"/out | sed 's/^ *\[ *[0-9]*\]//' | awk '$1 == ".init_array" { print $3, $5 }')
+start=$(echo $sec | cut -d' ' -f1)
+end=$(printf '%016x' $((0x$start + 0x$(echo $sec | cut -d' ' -f2))))
+readelf -sW "$t"/out | grep -q "$start .* __init_array_start$"
+readelf -sW "$t"/out | grep -q "$end .* __init_array_end$"
+
+# 链接器不提供的隐藏符号仍然要报错
+cat <<EOF | $CC -o "$t"/d.o -c -xassembler -
+.globl _start
+.hidden not_provided
+_start:
+  call not_provided
+EOF
+
+$CC -B. -nostdlib -static "$t"/d.o -o "$t"/out > "$t"/log 2>&1 || true
+grep -q 'undefined hidden symbol: not_provided' "$t"/log
@@ -0,0 +1,46 @@
+#!/bin/bash
+set -e
+
+test_name=$(basename "$0" .sh)
+t=out/tests/$test_name
+mkdir -p "$t"
+
+cat <<EOF | $CC -o "$t"/a.o -c -xassembler -
+.globl _start
+_start:
+  call foo
+  call bar
+  ret
+EOF
+
+cat <<EOF | $CC -o "$t"/foo.o -c -xassembler -
+.globl foo
+foo:
+  ret
+EOF
+
+cat <<EOF | $CC -o "$t"/bar.o -c -xassembler -
+.globl bar
+bar:
+  ret
+EOF
+
+rm -f "$t"/libfoo.a "$t"/libbar.a
+ar rcs "$t"/libfoo.a "$t"/foo.o
+ar rcs "$t"/libbar.a "$t"/bar.o
+
+./ld -static "$t"/libfoo.a "$t"/libbar.a "$t"/a.o -o "$t"/out --warn-backrefs \
+  > "$t"/log 2>&1 || true
+grep -q 'backward reference detected: foo' "$t"/log
+grep -q 'backward reference detected: bar' "$t"/log
+
+# --whole-archive区域内的归档成员和目标文件一样全部链接进来，
+# --no-whole-archive之后恢复按需拉入
+./ld -static --whole-archive "$t"/libfoo.a --no-whole-archive "$t"/libbar.a "$t"/a.o \
+  -o "$t"/out --warn-backrefs > "$t"/log 2>&1 || true
+! grep -q 'backward reference detected: foo' "$t"/log || false
+grep -q 'backward reference detected: bar' "$t"/log
+
+./ld -static --whole-archive "$t"/libfoo.a "$t"/libbar.a --no-whole-archive "$t"/a.o \
+  -o "$t"/out --warn-backrefs > "$t"/log 2>&1
+! grep -q 'backward reference' "$t"/log || false